@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Export = &cli.Command{
+	Name:      "export",
+	UsageText: "nix-search-tv export [--indexes a,b] -o bundle.tar.zst",
+	Usage:     "Write the indexed packages into a bundle, that can be imported on another machine",
+	Action:    ExportAction,
+	Flags:     ExportFlags(),
+}
+
+func ExportFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.StringFlag{
+			Name:     OutputFlag,
+			Aliases:  []string{"o"},
+			Usage:    "path to the bundle",
+			Required: true,
+		},
+	)
+}
+
+const OutputFlag = "output"
+
+var Import = &cli.Command{
+	Name:      "import",
+	UsageText: "nix-search-tv import bundle.tar.zst",
+	Usage:     "Replace the indexes with the ones from the bundle, created by the export command",
+	Action:    ImportAction,
+	Flags:     BaseFlags(),
+}
+
+func ExportAction(ctx context.Context, cmd *cli.Command) error {
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+
+	path := cmd.String(OutputFlag)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	defer file.Close()
+
+	err = indexer.ExportBundle(file, conf.CacheDir, requested)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		// Do not leave a broken bundle behind
+		os.Remove(path)
+		return fmt.Errorf("export: %w", err)
+	}
+
+	fmt.Fprintf(Stdout, "exported %s into %s\n", strings.Join(requested, ", "), path)
+
+	return nil
+}
+
+func ImportAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return errors.New("path to the bundle is required")
+	}
+
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+
+	file, err := os.Open(cmd.Args().First())
+	if err != nil {
+		return fmt.Errorf("open bundle: %w", err)
+	}
+	defer file.Close()
+
+	imported, err := indexer.ImportBundle(file, indexingOptions(conf), available)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	for _, index := range imported {
+		md, err := indexer.GetIndexMetadata(conf.CacheDir, index)
+		if err != nil {
+			return fmt.Errorf("%s: get metadata: %w", index, err)
+		}
+		fmt.Fprintf(Stdout, "%s: imported %s\n", index, md.CurrRelease)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestExportImport(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "bundle.tar.zst")
+
+	// Index and export on one machine...
+	state := setup(t)
+	setNixpkgs("fzf", "tv")
+	printCmd(t, "--indexes", indices.Nixpkgs)
+
+	err := runBundleCmd(t, ExportAction, ExportFlags(), "export", "--indexes", indices.Nixpkgs, "-o", bundle)
+	assert.NoError(t, err)
+
+	// ...and import on another one, that has no access to the fetchers
+	state = setup(t)
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs},
+	})
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs: &FailFetcher{},
+	})
+
+	err = runBundleCmd(t, ImportAction, BaseFlags(), "import", bundle)
+	assert.NoError(t, err)
+	assert.Equal(t, "nixpkgs: imported latest\n", state.Stdout.String())
+	state.Stdout.Reset()
+
+	printCmd(t, "--offline")
+	assert.Equal(t, []string{"fzf", "tv", ""}, strings.Split(state.Stdout.String(), "\n"))
+
+	pkg, err := indexer.LoadKey(filepath.Join(state.CacheDir, "nix-search-tv"), indices.Nixpkgs, "tv")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(pkg))
+}
+
+func TestExportNotIndexed(t *testing.T) {
+	setup(t)
+
+	bundle := filepath.Join(t.TempDir(), "bundle.tar.zst")
+	err := runBundleCmd(t, ExportAction, ExportFlags(), "export", "--indexes", indices.Nixpkgs, "-o", bundle)
+	assert.IsError(t, err, indexer.ErrNotIndexed)
+}
+
+func runBundleCmd(t *testing.T, action cli.ActionFunc, flags []cli.Flag, args ...string) error {
+	t.Helper()
+
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  flags,
+		Action: action,
+	}
+	return cmd.Run(context.TODO(), args)
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestChannels(t *testing.T) {
+	channels := map[string]any{
+		"nixpkgs-stable": map[string]string{
+			"type":    indices.Nixpkgs,
+			"channel": "nixos-24.11",
+		},
+		"nixos-stable": map[string]string{
+			"type":    indices.NixOS,
+			"channel": "nixos-24.11",
+		},
+	}
+
+	// indexChannels builds the channel indexes beforehand, so
+	// that the commands can run offline without the real fetchers
+	indexChannels := func(t *testing.T, state state) {
+		t.Helper()
+
+		indexes := []indexer.Index{
+			{
+				Name: "nixpkgs-stable",
+				Fetcher: &ContentFetcher{pkgs: map[string]string{
+					"fzf": `{"meta":{"position":"pkgs/by-name/fz/fzf/package.nix:42"}}`,
+				}},
+			},
+			{
+				Name: "nixos-stable",
+				Fetcher: &ContentFetcher{pkgs: map[string]string{
+					"programs.fzf.enable": `{"declarations":["nixos/modules/programs/fzf.nix"]}`,
+				}},
+			},
+		}
+		results := indexer.RunIndexing(context.TODO(), indexer.Options{
+			CacheDir: filepath.Join(state.CacheDir, "nix-search-tv"),
+		}, indexes)
+		for result := range results {
+			assert.NoError(t, result.Err)
+		}
+	}
+
+	t.Run("print", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{},
+			"experimental": map[string]any{
+				"channels": channels,
+			},
+		})
+		indexChannels(t, state)
+
+		printCmd(t, "--offline")
+
+		expected := []string{
+			"",
+			"nixos-stable/ programs.fzf.enable",
+			"nixpkgs-stable/ fzf",
+		}
+		output := strings.Split(state.Stdout.String(), "\n")
+		assertSortEqual(t, expected, output)
+	})
+
+	t.Run("source links to the channel", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{},
+			"experimental": map[string]any{
+				"channels": channels,
+			},
+		})
+		indexChannels(t, state)
+
+		err := runSource(t, "--offline", "nixpkgs-stable/ fzf")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://github.com/NixOS/nixpkgs/blob/nixos-24.11/pkgs/by-name/fz/fzf/package.nix", state.Stdout.String())
+
+		state.Stdout.Reset()
+		indices.Reset()
+		err = runSource(t, "--offline", "nixos-stable/ programs.fzf.enable")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://github.com/NixOS/nixpkgs/blob/nixos-24.11/nixos/modules/programs/fzf.nix", state.Stdout.String())
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			"experimental": map[string]any{
+				"channels": map[string]any{
+					"stable": map[string]string{
+						"type":    indices.Nixpkgs,
+						"channel": "stable",
+					},
+				},
+			},
+		})
+
+		err := runIndex(t)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `channel "stable": unknown channel "stable"`)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			"experimental": map[string]any{
+				"channels": map[string]any{
+					"stable": map[string]string{
+						"type":    "darwin",
+						"channel": "nixos-24.11",
+					},
+				},
+			},
+		})
+
+		err := runIndex(t)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `channel "stable" has unknown type "darwin"`)
+	})
+
+	t.Run("conflicts with builtin", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			"experimental": map[string]any{
+				"channels": map[string]any{
+					indices.Nixpkgs: map[string]string{
+						"type":    indices.Nixpkgs,
+						"channel": "nixos-24.11",
+					},
+				},
+			},
+		})
+
+		err := runIndex(t)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `channel "nixpkgs" conflicts with builtin "nixpkgs"`)
+	})
+}
+
+func runSource(t *testing.T, args ...string) error {
+	t.Helper()
+
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  PreviewFlags(),
+		Action: NewPreviewAction(sourcePreviews, nil),
+	}
+	return cmd.Run(context.TODO(), append([]string{"source"}, args...))
+}
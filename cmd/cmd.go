@@ -4,11 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/config"
 	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixreleases"
 
 	"github.com/urfave/cli/v3"
 )
@@ -34,6 +38,15 @@ func BaseFlags() []cli.Flag {
 			Hidden: true,
 			Usage:  "Path to the indexes cache directory",
 		},
+		&cli.BoolFlag{
+			Name:  OfflineFlag,
+			Usage: "never look for new releases, and use the indexed packages even if they are outdated",
+		},
+		&cli.BoolFlag{
+			Name:   NoDaemonFlag,
+			Hidden: true,
+			Usage:  "do not forward the command to the daemon, even if it is running",
+		},
 	}
 }
 
@@ -41,10 +54,14 @@ const (
 	ConfigFlag   = "config"
 	IndexesFlag  = "indexes"
 	CacheDirFlag = "cache-dir"
+	NoDaemonFlag = "no-daemon"
+	OfflineFlag  = "offline"
 )
 
 var Stdout io.ReadWriter = os.Stdout
 
+var Stderr io.Writer = os.Stderr
+
 func GetConfig(cmd *cli.Command) (config.Config, error) {
 	var conf config.Config
 	var err error
@@ -61,10 +78,14 @@ func GetConfig(cmd *cli.Command) (config.Config, error) {
 	if cmd.IsSet(CacheDirFlag) {
 		conf.CacheDir = cmd.String(CacheDirFlag)
 	}
+	conf.Offline = cmd.Bool(OfflineFlag)
 
 	if err = validateIndexes(conf, conf.Indexes); err != nil {
 		return config.Config{}, err
 	}
+	if err = validatePins(conf); err != nil {
+		return config.Config{}, err
+	}
 
 	if err := os.MkdirAll(conf.CacheDir, 0755); err != nil {
 		return conf, fmt.Errorf("cannot create cache directory: %w", err)
@@ -73,12 +94,60 @@ func GetConfig(cmd *cli.Command) (config.Config, error) {
 	return conf, nil
 }
 
+var reRevision = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func validatePins(conf config.Config) error {
+	if err := validateIndexes(conf, slices.Collect(maps.Keys(conf.Pins))); err != nil {
+		return fmt.Errorf("pins: %w", err)
+	}
+
+	for index, pin := range conf.Pins {
+		if pin.Release != "" && pin.Revision != "" {
+			return fmt.Errorf("%q is pinned to both a release and a revision, only one is allowed", index)
+		}
+		if pin.Revision != "" && !reRevision.MatchString(pin.Revision) {
+			return fmt.Errorf("%q is pinned to %q, expected a full git revision of 40 hex characters", index, pin.Revision)
+		}
+	}
+
+	return nil
+}
+
 func validateIndexes(conf config.Config, indexNames []string) error {
 	for index := range conf.Experimental.RenderDocsIndexes {
 		if indices.BuiltinIndexes[index] {
 			return fmt.Errorf("experimental %[1]q conflicts with builtin %[1]q", index)
 		}
 	}
+	for index := range conf.Experimental.PackagesURL {
+		if indices.BuiltinIndexes[index] {
+			return fmt.Errorf("experimental %[1]q conflicts with builtin %[1]q", index)
+		}
+	}
+	for index := range conf.Experimental.PackagesFile {
+		if indices.BuiltinIndexes[index] {
+			return fmt.Errorf("experimental %[1]q conflicts with builtin %[1]q", index)
+		}
+	}
+	for index, command := range conf.Experimental.Commands {
+		if indices.BuiltinIndexes[index] {
+			return fmt.Errorf("experimental %[1]q conflicts with builtin %[1]q", index)
+		}
+		if len(command) == 0 {
+			return fmt.Errorf("experimental %q has an empty command", index)
+		}
+	}
+	for index, channel := range conf.Experimental.Channels {
+		if indices.BuiltinIndexes[index] {
+			return fmt.Errorf("channel %[1]q conflicts with builtin %[1]q", index)
+		}
+		if channel.Type != indices.Nixpkgs && channel.Type != indices.NixOS {
+			return fmt.Errorf("channel %q has unknown type %q, expected %q or %q", index, channel.Type, indices.Nixpkgs, indices.NixOS)
+		}
+		if _, err := nixreleases.ChannelPrefix(channel.Channel); err != nil {
+			return fmt.Errorf("channel %q: %w", index, err)
+		}
+	}
 
 	for _, index := range indexNames {
 		if indices.BuiltinIndexes[index] {
@@ -86,7 +155,11 @@ func validateIndexes(conf config.Config, indexNames []string) error {
 		}
 
 		_, parseHTML := conf.Experimental.RenderDocsIndexes[index]
-		if !parseHTML {
+		_, channel := conf.Experimental.Channels[index]
+		_, packagesURL := conf.Experimental.PackagesURL[index]
+		_, packagesFile := conf.Experimental.PackagesFile[index]
+		_, command := conf.Experimental.Commands[index]
+		if !parseHTML && !channel && !packagesURL && !packagesFile && !command {
 			valid := strings.Join(indexNames, "\n")
 			return fmt.Errorf("unknown index %q. Valid values are:\n %s", index, valid)
 		}
@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Daemon = &cli.Command{
+	Name:      "daemon",
+	UsageText: "nix-search-tv daemon",
+	Usage:     "Keep the indexes open and serve print, preview and index commands over a unix socket",
+	Action:    DaemonAction,
+	Flags:     BaseFlags(),
+}
+
+const daemonSocket = "daemon.sock"
+
+// daemonRequest is sent by a client to the daemon. The daemon answers
+// with a sequence of frames (see `writeFrame`) and closes the connection
+type daemonRequest struct {
+	Command string   `json:"command"`
+	Indexes []string `json:"indexes"`
+	Package string   `json:"package,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Offline bool     `json:"offline,omitempty"`
+	Force   bool     `json:"force,omitempty"`
+
+	// Columns and Delimiter are the columns of the print command
+	Columns   []string `json:"columns,omitempty"`
+	Delimiter string   `json:"delimiter,omitempty"`
+
+	// Config is the digest of the client's config. See `configDigest`
+	Config string `json:"config"`
+}
+
+const (
+	frameOutput byte = 'o'
+	frameError  byte = 'e'
+	// frameRejected tells the client to serve the request itself,
+	// because the daemon runs with a different config
+	frameRejected byte = 'r'
+)
+
+// configDigest identifies the config, so that the daemon only serves
+// the clients configured the same way, like with the same config file,
+// cache directory and pins. The indexes and the offline mode are set
+// per request, so they are left out
+func configDigest(conf config.Config) string {
+	conf.Indexes = nil
+	conf.Offline = false
+
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func DaemonAction(ctx context.Context, cmd *cli.Command) error {
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+
+	path := filepath.Join(conf.CacheDir, daemonSocket)
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon is already listening on %s", path)
+	}
+	// The socket might be left by a daemon that was killed
+	_ = os.Remove(path)
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	defer lis.Close()
+
+	d := &daemon{
+		conf:   conf,
+		stores: map[string]*daemonStore{},
+	}
+	defer d.Close()
+
+	if !conf.Offline {
+		go d.refreshLoop(ctx, requested)
+	}
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
+	log.Printf("listening on %s", path)
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		go d.serve(ctx, conn)
+	}
+}
+
+type daemon struct {
+	conf config.Config
+
+	// indexing makes sure that scheduled refreshes and
+	// print requests never index at the same time. See `printIndexes`
+	indexing sync.Mutex
+
+	mu     sync.RWMutex
+	stores map[string]*daemonStore
+}
+
+type daemonStore struct {
+	index   indexer.Storage
+	release string
+	buildID string
+}
+
+// current reports whether the store is the index described by the metadata.
+// The release alone is not enough, as `index --force` rebuilds the same release
+func (s *daemonStore) current(md indexer.IndexMetadata) bool {
+	return s.release == md.CurrRelease && s.buildID == md.BuildID
+}
+
+func (d *daemon) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	req := daemonRequest{}
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		_ = writeFrame(conn, frameError, []byte(fmt.Sprintf("decode request: %s", err)))
+		return
+	}
+
+	if req.Config != configDigest(d.conf) {
+		_ = writeFrame(conn, frameRejected, nil)
+		return
+	}
+
+	out := bufio.NewWriter(&frameWriter{conn})
+	err := d.handle(ctx, out, req)
+	if flushErr := out.Flush(); flushErr != nil {
+		// The client is gone, there's no one to report the error to
+		return
+	}
+	if err != nil {
+		_ = writeFrame(conn, frameError, []byte(err.Error()))
+	}
+}
+
+func (d *daemon) handle(ctx context.Context, out io.Writer, req daemonRequest) error {
+	conf := d.conf
+	conf.Indexes = req.Indexes
+	conf.Offline = conf.Offline || req.Offline
+
+	switch req.Command {
+	case "print":
+		// The indexing is only waited for if the print needs it, so
+		// the prints of indexed packages are served during the refreshes
+		return printIndexes(ctx, out, conf, req.Indexes, printColumns{
+			Columns:   req.Columns,
+			Delimiter: req.Delimiter,
+		}, &d.indexing)
+
+	case "index":
+		d.indexing.Lock()
+		defer d.indexing.Unlock()
+
+		return runIndexes(ctx, out, conf, req.Indexes, req.Force)
+
+	case "preview", "source", "homepage":
+		var waiting WaitingFunc
+		if req.Command == "preview" {
+			waiting = PreviewWaiting
+		}
+
+		preview, waiting, err := formatPreview(previewCommands[req.Command], waiting, req.Format)
+		if err != nil {
+			return err
+		}
+		return previewPackage(out, conf, d.load, preview, waiting, req.Package)
+	}
+
+	return fmt.Errorf("unsupported command %q", req.Command)
+}
+
+// load is the daemon's `LoadFunc`. It keeps the indexes open between
+// the requests and re-opens them once the index is rebuilt
+func (d *daemon) load(cacheDir, index, key string) (json.RawMessage, error) {
+	md, err := indexer.GetIndexMetadata(cacheDir, index)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata: %w", err)
+	}
+
+	d.mu.RLock()
+	store, ok := d.stores[index]
+	if ok && store.current(md) {
+		defer d.mu.RUnlock()
+		return store.index.Load(key)
+	}
+	d.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	store, ok = d.stores[index]
+	if !ok || !store.current(md) {
+		if ok {
+			store.index.Close()
+			delete(d.stores, index)
+		}
+
+		storage, err := indexer.OpenIndex(cacheDir, index)
+		if err != nil {
+			return nil, fmt.Errorf("open indexer: %w", err)
+		}
+		store = &daemonStore{
+			index:   storage,
+			release: md.CurrRelease,
+			buildID: md.BuildID,
+		}
+		d.stores[index] = store
+	}
+
+	return store.index.Load(key)
+}
+
+// refreshLoop indexes the given indexes when they get older than the update interval.
+// The check runs at least hourly, so that a long update interval does not postpone
+// the indexing of an index that failed or was added after the daemon started
+func (d *daemon) refreshLoop(ctx context.Context, indexes []string) {
+	interval := min(time.Duration(d.conf.UpdateInterval), time.Hour)
+	ticker := time.NewTicker(max(interval, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx, indexes)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *daemon) refresh(ctx context.Context, names []string) {
+	d.indexing.Lock()
+	defer d.indexing.Unlock()
+
+	indexes, err := GetIndexes(d.conf, names)
+	if err != nil {
+		log.Printf("get indexes: %s", err)
+		return
+	}
+
+	needIndexing, err := indexer.NeedIndexing(
+		d.conf.CacheDir,
+		time.Duration(d.conf.UpdateInterval),
+		indexes,
+	)
+	if err != nil {
+		log.Printf("check if indexing needed: %s", err)
+		return
+	}
+
+	results := indexer.RunIndexing(ctx, indexingOptions(d.conf), needIndexing)
+	for result := range results {
+		if result.Err != nil {
+			log.Printf("%s: %s", result.Index, indexingFailure(result))
+			continue
+		}
+		log.Printf("%s: indexed", result.Index)
+	}
+}
+
+func (d *daemon) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for index, store := range d.stores {
+		store.index.Close()
+		delete(d.stores, index)
+	}
+
+	return nil
+}
+
+// callDaemon forwards the request to the daemon, if it is running, and
+// copies the response to the stdout. It reports whether the request was served by the daemon.
+//
+// If the daemon is not running, or runs with a different config, the
+// caller should serve the request itself
+func callDaemon(ctx context.Context, cmd *cli.Command, conf config.Config, req daemonRequest) (bool, error) {
+	if cmd.Bool(NoDaemonFlag) {
+		return false, nil
+	}
+
+	dialer := net.Dialer{Timeout: time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", filepath.Join(conf.CacheDir, daemonSocket))
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	req.Config = configDigest(conf)
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return false, nil
+	}
+
+	rd := bufio.NewReader(conn)
+	for {
+		typ, data, err := readFrame(rd)
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return true, fmt.Errorf("read daemon response: %w", err)
+		}
+
+		switch typ {
+		case frameRejected:
+			return false, nil
+		case frameOutput:
+			Stdout.Write(data)
+		case frameError:
+			return true, errors.New(string(data))
+		default:
+			return true, fmt.Errorf("unexpected frame type %q", typ)
+		}
+	}
+}
+
+// writeFrame writes a frame of the format:
+//
+//	| type (1 byte) | data length (4 bytes) | data |
+func writeFrame(w io.Writer, typ byte, data []byte) error {
+	header := [5]byte{typ}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readFrame(rd io.Reader) (byte, []byte, error) {
+	header := [5]byte{}
+	if _, err := io.ReadFull(rd, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(rd, data); err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], data, nil
+}
+
+// frameWriter wraps everything written into output frames
+type frameWriter struct {
+	w io.Writer
+}
+
+func (fw *frameWriter) Write(p []byte) (int, error) {
+	if err := writeFrame(fw.w, frameOutput, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
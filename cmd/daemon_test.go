@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestDaemon(t *testing.T) {
+	state := setup(t)
+
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{},
+		"experimental": map[string]any{
+			"options_file": map[string]string{
+				"file": pwd + "/testdata/options.json",
+			},
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		cmd := cli.Command{
+			Writer: io.Discard,
+			Flags:  BaseFlags(),
+			Action: DaemonAction,
+		}
+		done <- cmd.Run(ctx, []string{"daemon"})
+	}()
+
+	socket := filepath.Join(state.CacheDir, "nix-search-tv", daemonSocket)
+	assert.True(t, waitFor(func() bool {
+		_, err := os.Stat(socket)
+		return err == nil
+	}), "daemon did not start")
+
+	// The daemon and the commands below run in the same process, so
+	// reset the indexes registered by the daemon to let the commands register them again
+	indices.Reset()
+
+	t.Run("print", func(t *testing.T) {
+		state.Stdout.Reset()
+		printCmd(t)
+
+		expected := []string{
+			"age.ageBin",
+			"nixvim.autoCmd",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stdout.String(), "\n"))
+	})
+
+	t.Run("preview", func(t *testing.T) {
+		state.Stdout.Reset()
+		err := runPreview(t, "--indexes", "file", "age.ageBin")
+		assert.NoError(t, err)
+		assert.Contains(t, state.Stdout.String(), "The age executable to use.")
+	})
+
+	t.Run("errors are forwarded", func(t *testing.T) {
+		state.Stdout.Reset()
+		err := runPreview(t, "--indexes", "file", "unknown")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "key not found")
+	})
+
+	t.Run("different config is served locally", func(t *testing.T) {
+		// The same indexes, but with a custom preview, which only the
+		// client knows about. The daemon must not serve the default one
+		confPath := filepath.Join(t.TempDir(), "config.json")
+		data, err := json.Marshal(map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{},
+			"experimental": map[string]any{
+				"options_file": map[string]string{
+					"file": pwd + "/testdata/options.json",
+				},
+			},
+			"preview_templates": map[string]string{
+				"file": "custom {{ .Name }}\n",
+			},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(confPath, data, 0666))
+
+		indices.Reset()
+		state.Stdout.Reset()
+		err = runPreview(t, "--config", confPath, "--indexes", "file", "age.ageBin")
+		assert.NoError(t, err)
+		assert.Equal(t, "custom age.ageBin\n", state.Stdout.String())
+	})
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	_, err = os.Stat(socket)
+	assert.IsError(t, err, fs.ErrNotExist)
+}
+
+func TestDaemonReopensRebuiltIndex(t *testing.T) {
+	cacheDir := t.TempDir()
+	opts := indexer.Options{CacheDir: cacheDir}
+
+	index := func(content string, force bool) {
+		opts.Force = force
+		results := indexer.RunIndexing(context.TODO(), opts, []indexer.Index{{
+			Name: indices.Nixpkgs,
+			Fetcher: &ContentFetcher{pkgs: map[string]string{
+				"hello": content,
+			}},
+		}})
+		for result := range results {
+			assert.NoError(t, result.Err)
+		}
+	}
+
+	d := &daemon{stores: map[string]*daemonStore{}}
+	defer d.Close()
+
+	index(`{"version":"1"}`, false)
+	pkg, err := d.load(cacheDir, indices.Nixpkgs, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":"1"}`, string(pkg))
+
+	// The release is the same, but the index is rebuilt
+	// while the daemon keeps the previous one open
+	index(`{"version":"2"}`, true)
+	pkg, err = d.load(cacheDir, indices.Nixpkgs, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":"2"}`, string(pkg))
+}
+
+func TestPrintWaitsForIndexing(t *testing.T) {
+	state := setup(t)
+
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs: &ContentFetcher{pkgs: map[string]string{"hello": "{}"}},
+	})
+	conf := config.Config{
+		CacheDir:             filepath.Join(state.CacheDir, "nix-search-tv"),
+		EnableWaitingMessage: true,
+		UpdateInterval:       config.Duration(time.Hour),
+	}
+
+	// The lock is held by an indexing running elsewhere, like a refresh of the daemon
+	indexing := &sync.Mutex{}
+	indexing.Lock()
+
+	out := &syncBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- printIndexes(context.TODO(), out, conf, []string{indices.Nixpkgs}, printColumns{}, indexing)
+	}()
+
+	assert.True(t, waitFor(func() bool {
+		return out.String() == waitingMessage+"\n"
+	}), "no waiting message while waiting for the indexing")
+
+	indexing.Unlock()
+	assert.NoError(t, <-done)
+	assert.Equal(t, waitingMessage+"\nhello\n", out.String())
+}
+
+// syncBuffer is a buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(cond func() bool) bool {
+	for range 100 {
+		if cond() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
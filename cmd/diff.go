@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixpkgs"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Diff = &cli.Command{
+	Name:      "diff",
+	UsageText: "nix-search-tv diff [--index nixpkgs] [from] [to]",
+	Usage: "Print packages added, removed or updated between two releases of an index. " +
+		"By default, compares the current release with the previous one",
+	Action: DiffAction,
+	Flags:  DiffFlags(),
+}
+
+func DiffFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.StringFlag{
+			Name:  IndexFlag,
+			Usage: "what index to compare the releases of",
+			Value: indices.Nixpkgs,
+		},
+		&cli.BoolFlag{
+			Name:  ListFlag,
+			Usage: "list the known releases of the index",
+		},
+	)
+}
+
+const (
+	IndexFlag = "index"
+	ListFlag  = "list"
+)
+
+func DiffAction(ctx context.Context, cmd *cli.Command) error {
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	index := cmd.String(IndexFlag)
+	if !slices.Contains(available, index) {
+		return fmt.Errorf("%w: %s", ErrUnknownIndex, index)
+	}
+
+	releases, err := indexer.ListReleases(conf.CacheDir, index)
+	if err != nil {
+		return fmt.Errorf("list releases: %w", err)
+	}
+
+	if cmd.Bool(ListFlag) {
+		for _, release := range releases {
+			current := ""
+			if release.Current {
+				current = " (current)"
+			}
+			fmt.Fprintf(Stdout, "%s  %s%s\n", release.Metadata.LastIndexedAt.Format(time.DateTime), release.Name(), current)
+		}
+		return nil
+	}
+
+	if len(releases) < 2 {
+		return fmt.Errorf("%s has less than two releases to compare, set keep_releases in the config to keep the previous releases", index)
+	}
+
+	from, to := releases[len(releases)-2], releases[len(releases)-1]
+	args := cmd.Args().Slice()
+	if len(args) > 2 {
+		return errors.New("at most two releases can be compared")
+	}
+	if len(args) > 0 {
+		from, err = findRelease(releases, args[0])
+		if err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		to, err = findRelease(releases, args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return diffReleases(from, to)
+}
+
+// findRelease returns the release with the given name. To save typing
+// the long release names, any unique part of the name works too
+func findRelease(releases []indexer.Release, name string) (indexer.Release, error) {
+	for _, release := range releases {
+		if release.Name() == name {
+			return release, nil
+		}
+	}
+
+	matches := slices.DeleteFunc(slices.Clone(releases), func(release indexer.Release) bool {
+		return !strings.Contains(release.Name(), name)
+	})
+	switch len(matches) {
+	case 0:
+		return indexer.Release{}, fmt.Errorf("unknown release %q", name)
+	case 1:
+		return matches[0], nil
+	}
+
+	return indexer.Release{}, fmt.Errorf("%q matches %d releases, be more specific", name, len(matches))
+}
+
+func diffReleases(from, to indexer.Release) error {
+	fromKeys, err := from.Keys()
+	if err != nil {
+		return fmt.Errorf("%s: %w", from.Name(), err)
+	}
+	toKeys, err := to.Keys()
+	if err != nil {
+		return fmt.Errorf("%s: %w", to.Name(), err)
+	}
+
+	fromStore, err := from.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", from.Name(), err)
+	}
+	defer fromStore.Close()
+
+	toStore, err := to.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", to.Name(), err)
+	}
+	defer toStore.Close()
+
+	slices.Sort(fromKeys)
+	slices.Sort(toKeys)
+
+	added := []string{}
+	for _, key := range toKeys {
+		if _, ok := slices.BinarySearch(fromKeys, key); !ok {
+			added = append(added, key)
+		}
+	}
+
+	removed := []string{}
+	updated := []string{}
+	for _, key := range fromKeys {
+		if _, ok := slices.BinarySearch(toKeys, key); !ok {
+			removed = append(removed, key)
+			continue
+		}
+
+		prev, err := loadVersion(fromStore, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", from.Name(), err)
+		}
+		next, err := loadVersion(toStore, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", to.Name(), err)
+		}
+		if prev != next {
+			updated = append(updated, fmt.Sprintf("%s: %s -> %s", key, prev, next))
+		}
+	}
+
+	for _, key := range added {
+		fmt.Fprintf(Stdout, "+ %s\n", key)
+	}
+	for _, key := range removed {
+		fmt.Fprintf(Stdout, "- %s\n", key)
+	}
+	for _, line := range updated {
+		fmt.Fprintf(Stdout, "~ %s\n", line)
+	}
+
+	return nil
+}
+
+// loadVersion returns the version of the package. Options
+// have no versions, so they are only reported as added or removed
+func loadVersion(store indexer.Storage, key string) (string, error) {
+	content, err := store.Load(key)
+	if err != nil {
+		return "", fmt.Errorf("load %s: %w", key, err)
+	}
+
+	pkg := nixpkgs.Package{}
+	if err := json.Unmarshal(injectKey(key, content), &pkg); err != nil {
+		return "", nil
+	}
+
+	return pkg.GetVersion(), nil
+}
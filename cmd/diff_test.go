@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestDiff(t *testing.T) {
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs},
+		"keep_releases":                1,
+		// Index a new release on every print
+		config.UpdateIntervalTag: "1ns",
+	})
+
+	releases := []map[string]string{
+		{
+			"hello": `{"version":"2.12"}`,
+			"fzf":   `{"version":"0.60"}`,
+		},
+		{
+			"hello": `{"version":"2.12"}`,
+			"fzf":   `{"version":"0.61"}`,
+			"tv":    `{"version":"0.11"}`,
+		},
+		{
+			"fzf": `{"version":"0.62"}`,
+			"tv":  `{"version":"0.11"}`,
+		},
+	}
+	for i, pkgs := range releases {
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &ContentFetcher{
+				pkgs:    pkgs,
+				release: "nixpkgs-release-" + string(rune('a'+i)),
+			},
+		})
+		printCmd(t)
+	}
+
+	t.Run("only the last releases are kept", func(t *testing.T) {
+		state.Stdout.Reset()
+
+		diffCmd(t, "--list")
+
+		lines := strings.Split(strings.TrimSpace(state.Stdout.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+		assert.True(t, strings.HasSuffix(lines[0], "nixpkgs-release-b"))
+		assert.True(t, strings.HasSuffix(lines[1], "nixpkgs-release-c (current)"))
+
+		entries, err := os.ReadDir(filepath.Join(state.CacheDir, "nix-search-tv", indices.Nixpkgs+".history"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+	})
+
+	t.Run("previous and current releases by default", func(t *testing.T) {
+		state.Stdout.Reset()
+
+		diffCmd(t)
+
+		expected := "- hello\n" +
+			"~ fzf: 0.61 -> 0.62\n"
+		assert.Equal(t, expected, state.Stdout.String())
+	})
+
+	t.Run("releases by a part of their names", func(t *testing.T) {
+		state.Stdout.Reset()
+
+		diffCmd(t, "release-c", "release-b")
+
+		expected := "+ hello\n" +
+			"~ fzf: 0.62 -> 0.61\n"
+		assert.Equal(t, expected, state.Stdout.String())
+	})
+
+	t.Run("unknown release", func(t *testing.T) {
+		cmd := cli.Command{
+			Writer: io.Discard,
+			Flags:  DiffFlags(),
+			Action: DiffAction,
+		}
+		err := cmd.Run(context.TODO(), []string{"diff", "release-a"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown release")
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		cmd := cli.Command{
+			Writer: io.Discard,
+			Flags:  DiffFlags(),
+			Action: DiffAction,
+		}
+		err := cmd.Run(context.TODO(), []string{"diff", "--index", "../nixpkgs", "--list"})
+		assert.IsError(t, err, ErrUnknownIndex)
+
+		_, err = os.Stat(filepath.Join(state.CacheDir, "nixpkgs"))
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+}
+
+func diffCmd(t *testing.T, args ...string) {
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  DiffFlags(),
+		Action: DiffAction,
+	}
+	err := cmd.Run(context.TODO(), append([]string{"diff"}, args...))
+	assert.NoError(t, err)
+}
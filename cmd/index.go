@@ -1,22 +1,129 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"maps"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/3timeslazy/nix-search-tv/config"
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/command"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
 	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixos"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixpkgs"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixreleases"
 	"github.com/3timeslazy/nix-search-tv/indexes/optionsfile"
+	"github.com/3timeslazy/nix-search-tv/indexes/packagesurl"
 	"github.com/3timeslazy/nix-search-tv/indexes/renderdocs"
+
+	"github.com/urfave/cli/v3"
 )
 
+var Index = &cli.Command{
+	Name:      "index",
+	UsageText: "nix-search-tv index [--force] [--indexes a,b]",
+	Usage:     "Look for new releases and index them now, regardless of the update interval",
+	Action:    IndexAction,
+	Flags:     IndexFlags(),
+}
+
+func IndexFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.BoolFlag{
+			Name:  ForceFlag,
+			Usage: "rebuild the indexes even if there are no new releases",
+		},
+	)
+}
+
+const ForceFlag = "force"
+
 var ErrUnknownIndex = errors.New("unknown index")
 
+func IndexAction(ctx context.Context, cmd *cli.Command) error {
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+
+	served, err := callDaemon(ctx, cmd, conf, daemonRequest{
+		Command: cmd.Name,
+		Indexes: requested,
+		Force:   cmd.Bool(ForceFlag),
+		Offline: conf.Offline,
+	})
+	if served {
+		return err
+	}
+
+	return runIndexes(ctx, Stdout, conf, requested, cmd.Bool(ForceFlag))
+}
+
+// indexingFailure describes the failed indexing. The transient failures
+// are told apart, because they are likely to go away on the next attempt
+func indexingFailure(result indexer.IndexingResult) string {
+	if result.Transient {
+		return fmt.Sprintf("indexing failed temporarily: %s", result.Err)
+	}
+	return fmt.Sprintf("indexing failed: %s", result.Err)
+}
+
+// runIndexes indexes the requested indexes and reports the result
+// of each of them. It fails if any of the indexes failed
+func runIndexes(ctx context.Context, out io.Writer, conf config.Config, requested []string, force bool) error {
+	if conf.Offline {
+		return errors.New("cannot index in the offline mode")
+	}
+
+	indexes, err := GetIndexes(conf, requested)
+	if err != nil {
+		return fmt.Errorf("get indexes: %w", err)
+	}
+
+	opts := indexingOptions(conf)
+	opts.Force = force
+
+	failed := 0
+	for result := range indexer.RunIndexing(ctx, opts, indexes) {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "%s: %s\n", result.Index, indexingFailure(result))
+			continue
+		}
+		fmt.Fprintf(out, "%s: indexed\n", result.Index)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d indexes failed", failed, len(indexes))
+	}
+
+	return nil
+}
+
 func SetupIndexes(conf config.Config) ([]string, error) {
+	httputil.SetOptions(httputil.Options{
+		Timeout: time.Duration(conf.HTTP.Timeout),
+		Retries: conf.HTTP.Retries,
+		Backoff: httputil.DefaultOptions.Backoff,
+	})
+	nixreleases.SetEndpoints(nixreleases.Endpoints{
+		List:     conf.Releases.ListURL,
+		Download: conf.Releases.DownloadURL,
+		Channels: conf.Releases.ChannelsURL,
+	})
+
 	indexNames := slices.Collect(maps.Keys(indices.BuiltinIndexes))
 
 	for index, indexHTML := range conf.Experimental.RenderDocsIndexes {
@@ -36,6 +143,86 @@ func SetupIndexes(conf config.Config) ([]string, error) {
 		indexNames = append(indexNames, index)
 	}
 
+	for index, channel := range conf.Experimental.Channels {
+		var err error
+		switch channel.Type {
+		case indices.Nixpkgs:
+			err = indices.Register(
+				index,
+				nixpkgs.NewFetcher(channel.Channel),
+				func() indices.Pkg {
+					return &nixpkgs.Package{
+						Channel: channel.Channel,
+					}
+				},
+			)
+		case indices.NixOS:
+			err = indices.Register(
+				index,
+				nixos.NewFetcher(channel.Channel),
+				func() indices.Pkg {
+					return &nixos.Package{
+						Channel: channel.Channel,
+					}
+				},
+			)
+		default:
+			err = fmt.Errorf("unknown type %q", channel.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("register channel index %q: %w", index, err)
+		}
+
+		indexNames = append(indexNames, index)
+	}
+
+	for index, url := range conf.Experimental.PackagesURL {
+		err := indices.Register(
+			index,
+			packagesurl.NewFetcher(url),
+			func() indices.Pkg {
+				return &nixpkgs.Package{}
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("register packages_url index %q: %w", index, err)
+		}
+
+		indexNames = append(indexNames, index)
+	}
+
+	// The packages files are indexed the same way as the options
+	// files, only previewed as the nixpkgs packages
+	for index, path := range conf.Experimental.PackagesFile {
+		err := indices.Register(
+			index,
+			optionsfile.NewFetcher(path),
+			func() indices.Pkg {
+				return &nixpkgs.Package{Local: true}
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("register packages_file index %q: %w", index, err)
+		}
+
+		indexNames = append(indexNames, index)
+	}
+
+	for index, args := range conf.Experimental.Commands {
+		err := indices.Register(
+			index,
+			command.NewFetcher(args),
+			func() indices.Pkg {
+				return &command.Package{}
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("register commands index %q: %w", index, err)
+		}
+
+		indexNames = append(indexNames, index)
+	}
+
 	for index, path := range conf.Experimental.OptionsFile {
 		err := indices.Register(
 			index,
@@ -51,10 +238,20 @@ func SetupIndexes(conf config.Config) ([]string, error) {
 		indexNames = append(indexNames, index)
 	}
 
+	for index, text := range conf.PreviewTemplates {
+		if !slices.Contains(indexNames, index) {
+			return nil, fmt.Errorf("preview template for unknown index %q", index)
+		}
+		if err := indices.SetPreviewTemplate(index, text); err != nil {
+			return nil, fmt.Errorf("set preview template of %q: %w", index, err)
+		}
+	}
+
 	return indexNames, nil
 }
 
-func GetIndexes(cacheDir string, indexNames []string) ([]indexer.Index, error) {
+func GetIndexes(conf config.Config, indexNames []string) ([]indexer.Index, error) {
+	cacheDir := conf.CacheDir
 	indexes := []indexer.Index{}
 	for _, indexName := range indexNames {
 		fetcher, ok := indices.GetFetcher(indexName)
@@ -67,16 +264,29 @@ func GetIndexes(cacheDir string, indexNames []string) ([]indexer.Index, error) {
 			return nil, fmt.Errorf("get metadata for %q: %w", indexName, err)
 		}
 
+		pin := conf.Pins[indexName]
 		indexes = append(indexes, indexer.Index{
 			Name:     indexName,
 			Fetcher:  fetcher,
 			Metadata: md,
+			Pin: indexer.Pin{
+				Release:  pin.Release,
+				Revision: pin.Revision,
+			},
 		})
 	}
 
 	return indexes, nil
 }
 
+func indexingOptions(conf config.Config) indexer.Options {
+	return indexer.Options{
+		CacheDir:     conf.CacheDir,
+		Storage:      conf.Experimental.Storage,
+		KeepReleases: conf.KeepReleases,
+	}
+}
+
 // The two functions below connect the print and preview
 // commands. Their logic is simple, so the only reason
 // these functions exist is to keep prefix logic in one place
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixpkgs"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/andybalholm/brotli"
+	"github.com/urfave/cli/v3"
+)
+
+func TestIndex(t *testing.T) {
+	t.Run("ignores the update interval", func(t *testing.T) {
+		state := setup(t)
+
+		setNixpkgs("fzf")
+		err := runIndex(t, "--indexes", indices.Nixpkgs)
+		assert.NoError(t, err)
+		assert.Equal(t, "nixpkgs: indexed\n", state.Stdout.String())
+
+		// The release is the same, so nothing changes
+		setNixpkgs("fzf", "tv")
+		err = runIndex(t, "--indexes", indices.Nixpkgs)
+		assert.NoError(t, err)
+		assertSortEqual(t, []string{"fzf"}, getCache(t, state))
+	})
+
+	t.Run("force rebuilds the same release", func(t *testing.T) {
+		state := setup(t)
+
+		setNixpkgs("fzf")
+		err := runIndex(t, "--indexes", indices.Nixpkgs)
+		assert.NoError(t, err)
+
+		setNixpkgs("fzf", "tv")
+		err = runIndex(t, "--indexes", indices.Nixpkgs, "--force")
+		assert.NoError(t, err)
+		assertSortEqual(t, []string{"fzf", "tv"}, getCache(t, state))
+	})
+
+	t.Run("fails if an index failed", func(t *testing.T) {
+		state := setup(t)
+
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs:     &FailFetcher{},
+			indices.HomeManager: &PkgsFetcher{[]string{"programs.zsh"}},
+		})
+
+		err := runIndex(t, "--indexes", indices.Nixpkgs+","+indices.HomeManager)
+		assert.EqualError(t, err, "1 of 2 indexes failed")
+
+		output := state.Stdout.String()
+		assert.Contains(t, output, "nixpkgs: indexing failed: get latest release: failed to get latest release\n")
+		assert.Contains(t, output, "home-manager: indexed\n")
+	})
+
+	t.Run("transient failure", func(t *testing.T) {
+		state := setup(t)
+
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &TransientFetcher{},
+		})
+
+		err := runIndex(t, "--indexes", indices.Nixpkgs)
+		assert.EqualError(t, err, "1 of 1 indexes failed")
+		assert.Equal(t,
+			"nixpkgs: indexing failed temporarily: download latest release: expected http 200, but 503\n",
+			state.Stdout.String(),
+		)
+	})
+
+	t.Run("not allowed offline", func(t *testing.T) {
+		setup(t)
+
+		setNixpkgs("fzf")
+		err := runIndex(t, "--offline")
+		assert.EqualError(t, err, "cannot index in the offline mode")
+	})
+}
+
+func TestOffline(t *testing.T) {
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: true,
+		"indexes":                      []string{indices.Nixpkgs, indices.HomeManager},
+	})
+
+	setNixpkgs("fzf")
+	printCmd(t, "--indexes", indices.Nixpkgs)
+
+	// Both indexes need indexing, but the fetchers must never be called
+	setMetadata(t, state, indices.Nixpkgs, indexer.IndexMetadata{CurrRelease: "latest"})
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs:     &FailFetcher{},
+		indices.HomeManager: &FailFetcher{},
+	})
+	state.Stdout.Reset()
+
+	printCmd(t, "--offline")
+
+	assert.Equal(t, []string{"nixpkgs/ fzf", ""}, strings.Split(state.Stdout.String(), "\n"))
+}
+
+func TestReleasesMirror(t *testing.T) {
+	state := setup(t)
+
+	srv := releasesMirror(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(brotliPackages(t, "fzf"))
+	})
+	writeMirrorConfig(t, state, srv, 3)
+
+	err := runIndex(t)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fzf"}, getCache(t, state))
+
+	md, err := indexer.GetIndexMetadata(filepath.Join(state.CacheDir, "nix-search-tv"), indices.Nixpkgs)
+	assert.NoError(t, err)
+	assert.Equal(t, mirrorRelease, md.CurrRelease)
+}
+
+func TestResumeDownload(t *testing.T) {
+	state := setup(t)
+
+	packages := brotliPackages(t, "fzf", "tv")
+	ranges := []string{}
+	srv := releasesMirror(t, func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) > 1 {
+			http.ServeContent(w, r, "packages.json.br", time.Time{}, bytes.NewReader(packages))
+			return
+		}
+
+		// Drop the connection in the middle of the first download
+		w.Header().Set("Content-Length", strconv.Itoa(len(packages)))
+		w.Write(packages[:len(packages)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	})
+	writeMirrorConfig(t, state, srv, 0)
+
+	err := runIndex(t)
+	assert.EqualError(t, err, "1 of 1 indexes failed")
+	assert.Contains(t, state.Stdout.String(), "nixpkgs: indexing failed temporarily: ")
+
+	err = runIndex(t)
+	assert.NoError(t, err)
+	assertSortEqual(t, []string{"fzf", "tv"}, getCache(t, state))
+	assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(packages)/2)}, ranges)
+
+	// The download is not kept once the release is indexed
+	_, err = os.Stat(filepath.Join(state.CacheDir, "nix-search-tv", "nixpkgs.download"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+const mirrorRelease = "nixpkgs/nixpkgs-25.11pre800000.2222222222bb"
+
+// releasesMirror serves a single nixpkgs release with the given packages
+func releasesMirror(t *testing.T, packages http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<ListBucketResult><Contents><Key>%s</Key></Contents></ListBucketResult>", mirrorRelease)
+	})
+	mux.HandleFunc("/channels/nixpkgs-unstable/git-revision", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "2222222222bbffffffffffffffffffffffffffff")
+	})
+	mux.HandleFunc("/download/"+mirrorRelease+"/packages.json.br", packages)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func writeMirrorConfig(t *testing.T, state state, srv *httptest.Server, retries int) {
+	t.Helper()
+
+	writeXdgConfig(t, state, map[string]any{
+		"indexes": []string{indices.Nixpkgs},
+		"releases": map[string]string{
+			"list_url":     srv.URL + "/bucket",
+			"download_url": srv.URL + "/download",
+			"channels_url": srv.URL + "/channels",
+		},
+		"http": map[string]any{
+			"retries": retries,
+		},
+	})
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs: &nixpkgs.Fetcher{},
+	})
+}
+
+func brotliPackages(t *testing.T, pkgs ...string) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	bw := brotli.NewWriter(buf)
+	fmt.Fprint(bw, `{"packages":{`)
+	for i, pkg := range pkgs {
+		if i > 0 {
+			fmt.Fprint(bw, ",")
+		}
+		fmt.Fprintf(bw, "%q:{}", pkg)
+	}
+	fmt.Fprint(bw, "}}")
+	assert.NoError(t, bw.Close())
+
+	return buf.Bytes()
+}
+
+func runIndex(t *testing.T, args ...string) error {
+	t.Helper()
+
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  IndexFlags(),
+		Action: IndexAction,
+	}
+	return cmd.Run(context.TODO(), append([]string{"index"}, args...))
+}
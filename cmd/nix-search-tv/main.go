@@ -18,9 +18,20 @@ var root = &cli.Command{
 	Usage:     "Fuzzy search for Nix packages",
 	Commands: []*cli.Command{
 		cmd.Print,
+		cmd.Index,
 		cmd.Preview,
 		cmd.Source,
 		cmd.Homepage,
+		cmd.Search,
+		cmd.Query,
+		cmd.Provides,
+		cmd.CommandNotFound,
+		cmd.Snippet,
+		cmd.Daemon,
+		cmd.Diff,
+		cmd.Status,
+		cmd.Export,
+		cmd.Import,
 	},
 }
 
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestPin(t *testing.T) {
+	setConfig := func(state state, pin map[string]string) {
+		conf := map[string]any{
+			config.EnableWaitingMessageTag: false,
+			config.UpdateIntervalTag:       "1ns",
+			"indexes":                      []string{indices.Nixpkgs},
+		}
+		if pin != nil {
+			conf["pins"] = map[string]any{indices.Nixpkgs: pin}
+		}
+		writeXdgConfig(t, state, conf)
+	}
+
+	t.Run("release", func(t *testing.T) {
+		state := setup(t)
+		setConfig(state, map[string]string{"release": "pinned"})
+
+		fetcher := &ReleasesFetcher{latest: "latest"}
+		indices.SetFetchers(map[string]indexer.Fetcher{indices.Nixpkgs: fetcher})
+
+		printCmd(t)
+		assert.Equal(t, []string{"pinned"}, getCache(t, state))
+
+		// Never moves past the pin, even if the index is outdated
+		indices.SetFetchers(map[string]indexer.Fetcher{indices.Nixpkgs: &FailFetcher{}})
+		printCmd(t)
+		assert.Equal(t, []string{"pinned"}, getCache(t, state))
+
+		// Without the pin, the index gets updated right away
+		setConfig(state, nil)
+		indices.SetFetchers(map[string]indexer.Fetcher{indices.Nixpkgs: fetcher})
+		printCmd(t)
+		assert.Equal(t, []string{"latest"}, getCache(t, state))
+	})
+
+	t.Run("revision", func(t *testing.T) {
+		state := setup(t)
+		setConfig(state, map[string]string{"revision": "95ea544c84eb3f4d4f8b4d8b8e7d7c6b5a4f3e2d"})
+
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &ReleasesFetcher{latest: "latest"},
+		})
+
+		printCmd(t)
+		assert.Equal(t, []string{"nixpkgs-25.05pre1.95ea544c84eb"}, getCache(t, state))
+	})
+
+	t.Run("invalid pins", func(t *testing.T) {
+		state := setup(t)
+
+		tests := []struct {
+			pins     map[string]any
+			expected string
+		}{
+			{
+				map[string]any{"unknown": map[string]string{"release": "pinned"}},
+				"pins: unknown index",
+			},
+			{
+				map[string]any{indices.Nixpkgs: map[string]string{"revision": "95ea544c84eb"}},
+				`"nixpkgs" is pinned to "95ea544c84eb", expected a full git revision of 40 hex characters`,
+			},
+			{
+				map[string]any{indices.Nixpkgs: map[string]string{"release": "pinned", "revision": "95ea544c84eb3f4d4f8b4d8b8e7d7c6b5a4f3e2d"}},
+				`"nixpkgs" is pinned to both a release and a revision, only one is allowed`,
+			},
+		}
+		for _, test := range tests {
+			writeXdgConfig(t, state, map[string]any{
+				"indexes": []string{indices.Nixpkgs},
+				"pins":    test.pins,
+			})
+			err := runIndex(t)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		}
+	})
+
+	t.Run("index does not support pinning", func(t *testing.T) {
+		state := setup(t)
+		setConfig(state, map[string]string{"release": "pinned"})
+
+		setNixpkgs("fzf")
+
+		err := runIndex(t)
+		assert.EqualError(t, err, "1 of 1 indexes failed")
+		assert.Contains(t, state.Stdout.String(), "the index does not support pinning")
+	})
+}
@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/3timeslazy/nix-search-tv/config"
 	"github.com/3timeslazy/nix-search-tv/indexer"
 	"github.com/3timeslazy/nix-search-tv/indexes/indices"
 
@@ -17,60 +21,216 @@ import (
 
 var Preview = &cli.Command{
 	Name:      "preview",
-	UsageText: "nix-search-tv preview [package_name]",
+	UsageText: "nix-search-tv preview [--format ansi|plain|json|markdown] [package_name]",
 	Usage:     "Print package preview",
-	Action:    NewPreviewAction(indices.Preview),
-	Flags:     BaseFlags(),
+	Action:    NewPreviewAction(packagePreviews, PreviewWaiting),
+	Flags:     PreviewFlags(),
 }
 
+func PreviewFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.StringFlag{
+			Name:  FormatFlag,
+			Value: FormatANSI,
+			Usage: "the output format: ansi, plain, json or markdown",
+			Validator: func(format string) error {
+				if !slices.Contains(formats, format) {
+					return fmt.Errorf("unknown format %q, expected one of: %s", format, strings.Join(formats, ", "))
+				}
+				return nil
+			},
+		},
+		delimiterFlag(),
+	)
+}
+
+const FormatFlag = "format"
+
+const (
+	FormatANSI     = "ansi"
+	FormatPlain    = "plain"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+var formats = []string{FormatANSI, FormatPlain, FormatJSON, FormatMarkdown}
+
 type PreviewFunc func(index string, out io.Writer, pkg json.RawMessage) error
 
-func NewPreviewAction(preview PreviewFunc) cli.ActionFunc {
+// PreviewFormats maps the output formats to the preview functions
+type PreviewFormats map[string]PreviewFunc
+
+var (
+	packagePreviews = PreviewFormats{
+		FormatANSI:     indices.Preview,
+		FormatPlain:    indices.PlainPreview,
+		FormatJSON:     indices.JSONPreview,
+		FormatMarkdown: indices.MarkdownPreview,
+	}
+	sourcePreviews   = linkPreviews("source", indices.SourcePreview)
+	homepagePreviews = linkPreviews("homepage", indices.HomepagePreview)
+)
+
+// previewCommands are the formats of the preview commands by their names
+var previewCommands = map[string]PreviewFormats{
+	"preview":  packagePreviews,
+	"source":   sourcePreviews,
+	"homepage": homepagePreviews,
+}
+
+// linkPreviews returns the formats of a command printing a single link
+func linkPreviews(name string, link PreviewFunc) PreviewFormats {
+	return PreviewFormats{
+		FormatANSI:  link,
+		FormatPlain: link,
+		FormatJSON: func(index string, out io.Writer, pkg json.RawMessage) error {
+			buf := &bytes.Buffer{}
+			if err := link(index, buf, pkg); err != nil {
+				return err
+			}
+			return json.NewEncoder(out).Encode(map[string]string{name: buf.String()})
+		},
+		FormatMarkdown: func(index string, out io.Writer, pkg json.RawMessage) error {
+			buf := &bytes.Buffer{}
+			if err := link(index, buf, pkg); err != nil {
+				return err
+			}
+			if buf.Len() == 0 {
+				return nil
+			}
+			_, err := fmt.Fprintf(out, "<%s>\n", buf)
+			return err
+		},
+	}
+}
+
+// formatPreview picks the preview function of the format. Only the styled
+// preview shows the waiting banner, the other formats are meant for scripts
+// and return an error instead
+func formatPreview(previews PreviewFormats, waiting WaitingFunc, format string) (PreviewFunc, WaitingFunc, error) {
+	format = cmp.Or(format, FormatANSI)
+	preview, ok := previews[format]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+	if format != FormatANSI {
+		waiting = nil
+	}
+
+	return preview, waiting, nil
+}
+
+// WaitingFunc prints a placeholder for packages that cannot
+// be previewed until the indexing is finished
+type WaitingFunc func(out io.Writer, conf config.Config)
+
+var errIndexing = errors.New("the index is being built, try again once the indexing is finished")
+
+// NewPreviewAction returns an action loading the package and
+// passing it to the preview function.
+//
+// Fuzzy finders call the preview on every cursor move, so it must never
+// fail because of the indexing running in parallel. The policy is:
+//   - The current index is always readable, because new releases are
+//     indexed into a separate directory. So, the previews work as usual
+//   - If the index has never been built, or the package is missing from the
+//     current index while a new release is being indexed, call waiting.
+//     If waiting is nil, return an error instead
+func NewPreviewAction(previews PreviewFormats, waiting WaitingFunc) cli.ActionFunc {
 	return func(ctx context.Context, cmd *cli.Command) error {
 		fullPkgName := strings.Join(cmd.Args().Slice(), " ")
 		if fullPkgName == "" {
 			return errors.New("package name is required")
 		}
 
+		// The line printed with `print --columns` is passed as it
+		// is, so the columns following the name are cut off
+		fullPkgName, _, _ = strings.Cut(fullPkgName, delimiter(cmd))
+
+		format := cmd.String(FormatFlag)
+		preview, waiting, err := formatPreview(previews, waiting, format)
+		if err != nil {
+			return err
+		}
+
 		conf, err := GetConfig(cmd)
 		if err != nil {
 			return fmt.Errorf("get config: %w", err)
 		}
-		if fullPkgName == waitingMessage {
-			PreviewWaiting(Stdout, conf)
-			return nil
-		}
 
 		if cmd.IsSet(IndexesFlag) {
 			conf.Indexes = cmd.StringSlice(IndexesFlag)
 		}
 
+		served, err := callDaemon(ctx, cmd, conf, daemonRequest{
+			Command: cmd.Name,
+			Indexes: conf.Indexes,
+			Package: fullPkgName,
+			Format:  format,
+		})
+		if served {
+			return err
+		}
+
 		_, err = SetupIndexes(conf)
 		if err != nil {
 			return err
 		}
 
-		var index, pkgName string
+		return previewPackage(Stdout, conf, indexer.LoadKey, preview, waiting, fullPkgName)
+	}
+}
+
+// LoadFunc loads the package content from the index
+type LoadFunc func(cacheDir, index, key string) (json.RawMessage, error)
 
-		if len(conf.Indexes) == 1 {
-			index = conf.Indexes[0]
-			pkgName = fullPkgName
-		} else {
-			var ok bool
-			index, pkgName, ok = cutIndexPrefix(fullPkgName)
-			if !ok {
-				return errors.New("multiple indexes requested, but the package has no index prefix")
-			}
+func previewPackage(
+	out io.Writer,
+	conf config.Config,
+	load LoadFunc,
+	preview PreviewFunc,
+	waiting WaitingFunc,
+	fullPkgName string,
+) error {
+	wait := func() error {
+		if waiting == nil {
+			return errIndexing
 		}
+		waiting(out, conf)
+		return nil
+	}
 
-		pkg, err := indexer.LoadKey(conf.CacheDir, index, pkgName)
-		if err != nil {
-			return fmt.Errorf("load package content: %w", err)
+	if fullPkgName == waitingMessage {
+		return wait()
+	}
+
+	var index, pkgName string
+
+	if len(conf.Indexes) == 1 {
+		index = conf.Indexes[0]
+		pkgName = fullPkgName
+	} else {
+		var ok bool
+		index, pkgName, ok = cutIndexPrefix(fullPkgName)
+		if !ok {
+			return errors.New("multiple indexes requested, but the package has no index prefix")
 		}
-		pkg = injectKey(pkgName, pkg)
+	}
 
-		return preview(index, Stdout, pkg)
+	pkg, err := load(conf.CacheDir, index, pkgName)
+	if errors.Is(err, indexer.ErrNotIndexed) {
+		return wait()
 	}
+	if errors.Is(err, indexer.ErrNotFound) && indexer.IsIndexing(conf.CacheDir, index) {
+		return wait()
+	}
+	if err != nil {
+		return fmt.Errorf("load package content: %w", err)
+	}
+	pkg = injectKey(pkgName, pkg)
+
+	return preview(index, out, pkg)
 }
 
 // injectKey appends the `_key` field into the json object.
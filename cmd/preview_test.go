@@ -1,9 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
 	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
 )
 
 func TestInjectKey(t *testing.T) {
@@ -19,3 +31,241 @@ func TestInjectKey(t *testing.T) {
 		assert.Equal(t, []byte(`{"_key":"package.\"with quotes\"", "version": "v1.0.0" }`), pkg)
 	})
 }
+
+func TestPreviewConcurrency(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	optionsPath := pwd + "/testdata/options.json"
+
+	t.Run("index is opened by another process", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{},
+			"experimental": map[string]any{
+				"options_file": map[string]string{
+					"file": optionsPath,
+				},
+			},
+		})
+		printCmd(t)
+
+		// Hold the index open, like a preview running in parallel would
+		bdg, err := indexer.NewBadger(indexer.BadgerConfig{
+			Dir:      filepath.Join(state.CacheDir, "nix-search-tv", "file", "badger"),
+			ReadOnly: true,
+		})
+		assert.NoError(t, err)
+		defer bdg.Close()
+
+		indices.Reset()
+		state.Stdout.Reset()
+		err = runPreview(t, "--indexes", "file", "age.ageBin")
+		assert.NoError(t, err)
+		assert.Contains(t, state.Stdout.String(), "The age executable to use.")
+	})
+
+	t.Run("index is not built yet", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs},
+		})
+
+		err := runPreview(t, "nix-search-tv")
+		assert.NoError(t, err)
+		assert.Contains(t, state.Stdout.String(), "Looking for packages updates")
+	})
+
+	t.Run("index is being built", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			"indexes": []string{indices.Nixpkgs},
+		})
+		progress := `[{"index":"nixpkgs","phase":"downloading","downloaded":15728640,"total":31457280,"packages":52341}]`
+		cacheDir := filepath.Join(state.CacheDir, "nix-search-tv")
+		assert.NoError(t, os.MkdirAll(cacheDir, 0755))
+		// The progress is only shown for the running processes, like this one
+		name := fmt.Sprintf("indexing-%d-1.json", os.Getpid())
+		err := os.WriteFile(filepath.Join(cacheDir, name), []byte(progress), 0666)
+		assert.NoError(t, err)
+
+		err = runPreview(t, "nix-search-tv")
+		assert.NoError(t, err)
+		assert.Contains(t, state.Stdout.String(), "  index     phase         downloaded        packages\n")
+		assert.Contains(t, state.Stdout.String(), "  nixpkgs   downloading   50% of 30.0 MiB   52341\n")
+	})
+
+	t.Run("new package while indexing", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs},
+		})
+		setNixpkgs("nix-search-tv")
+		printCmd(t)
+
+		staging := filepath.Join(state.CacheDir, "nix-search-tv", indices.Nixpkgs+".staging")
+		assert.NoError(t, os.MkdirAll(staging, 0755))
+
+		state.Stdout.Reset()
+		err := runPreview(t, "television")
+		assert.NoError(t, err)
+		assert.Contains(t, state.Stdout.String(), "Looking for packages updates")
+	})
+
+	t.Run("source while indexing", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs},
+		})
+
+		cmd := cli.Command{
+			Writer: io.Discard,
+			Flags:  PreviewFlags(),
+			Action: NewPreviewAction(sourcePreviews, nil),
+		}
+		err := cmd.Run(context.TODO(), []string{"source", "nix-search-tv"})
+		assert.IsError(t, err, errIndexing)
+		assert.True(t, strings.TrimSpace(state.Stdout.String()) == "")
+	})
+}
+
+func runPreview(t *testing.T, args ...string) error {
+	t.Helper()
+
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  PreviewFlags(),
+		Action: NewPreviewAction(packagePreviews, PreviewWaiting),
+	}
+	return cmd.Run(context.TODO(), append([]string{"preview"}, args...))
+}
+
+func TestPreviewTemplates(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	packagesPath := pwd + "/testdata/packages.json"
+
+	writeConfig := func(t *testing.T, state state, template string) {
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{"overlay"},
+			"experimental": map[string]any{
+				"packages_file": map[string]string{
+					"overlay": packagesPath,
+				},
+			},
+			"preview_templates": map[string]string{
+				"overlay": template,
+			},
+		})
+	}
+
+	t.Run("custom template", func(t *testing.T) {
+		state := setup(t)
+		writeConfig(t, state, `{{ .Name }} {{ .GetVersion }}: {{ .Meta.Description }}{{ with field "meta.position" }} at {{ . }}{{ end }}{{ with field "system" }} ({{ . }}){{ end }}`)
+		printCmd(t)
+
+		indices.Reset()
+		state.Stdout.Reset()
+		err := runPreview(t, "hello-overlay")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-overlay 2.12.1: Hello from the private overlay at /nix/store/abc-overlay/pkgs/hello/default.nix:12 (x86_64-linux)", state.Stdout.String())
+
+		indices.Reset()
+		state.Stdout.Reset()
+		err = runPreview(t, "internal-cli")
+		assert.NoError(t, err)
+		assert.Equal(t, "internal-cli 0.4.0: Command line tool for the internal services (x86_64-linux)", state.Stdout.String())
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		state := setup(t)
+		writeConfig(t, state, `{{ .Name `)
+
+		err := runPreview(t, "hello-overlay")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `set preview template of "overlay": parse preview template`)
+	})
+}
+
+func TestPreviewFormats(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	packagesPath := pwd + "/testdata/packages.json"
+
+	state := setup(t)
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{"overlay"},
+		"experimental": map[string]any{
+			"packages_file": map[string]string{
+				"overlay": packagesPath,
+			},
+		},
+	})
+	printCmd(t)
+
+	preview := func(t *testing.T, args ...string) string {
+		t.Helper()
+
+		indices.Reset()
+		state.Stdout.Reset()
+		err := runPreview(t, args...)
+		assert.NoError(t, err)
+		return state.Stdout.String()
+	}
+
+	t.Run("json", func(t *testing.T) {
+		output := preview(t, "--format", "json", "hello-overlay")
+		assert.Equal(t, `{
+  "name": "hello-overlay",
+  "version": "2.12.1",
+  "description": "Hello from the private overlay",
+  "declarations": [
+    "/nix/store/abc-overlay/pkgs/hello/default.nix:12"
+  ]
+}
+`, output)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		output := preview(t, "--format", "markdown", "hello-overlay")
+		assert.Equal(t, "### `hello-overlay` 2.12.1\n\n"+
+			"Hello from the private overlay\n\n"+
+			"- **Declared in:** `/nix/store/abc-overlay/pkgs/hello/default.nix:12`\n", output)
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		output := preview(t, "--format", "plain", "hello-overlay")
+		assert.NotContains(t, output, "\x1b[")
+		assert.Contains(t, output, "hello-overlay (2.12.1)\n")
+		assert.Contains(t, output, "license (free)\nNo License\n")
+	})
+
+	t.Run("source as json", func(t *testing.T) {
+		indices.Reset()
+		state.Stdout.Reset()
+		err := runSource(t, "--format", "json", "hello-overlay")
+		assert.NoError(t, err)
+
+		link := map[string]string{}
+		err = json.Unmarshal(state.Stdout.Bytes(), &link)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasSuffix(link["source"], "/pkgs/hello/default.nix"))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		indices.Reset()
+		err := runPreview(t, "--format", "html", "hello-overlay")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown format "html"`)
+	})
+}
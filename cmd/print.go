@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/3timeslazy/nix-search-tv/config"
@@ -15,10 +20,89 @@ import (
 
 var Print = &cli.Command{
 	Name:      "print",
-	UsageText: "nix-search-tv print",
+	UsageText: "nix-search-tv print [--columns name,version,description] [--delimiter <delimiter>]",
 	Usage:     "Print indexed package names. If there is no indexed packages, they'll get indexed first",
 	Action:    PrintAction,
-	Flags:     BaseFlags(),
+	Flags:     PrintFlags(),
+}
+
+func PrintFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.StringSliceFlag{
+			Name:  ColumnsFlag,
+			Value: []string{indexer.ColumnName},
+			Usage: "the columns to print, the first one must be the name. Available columns: " + strings.Join(indexer.Columns, ", "),
+			Validator: func(columns []string) error {
+				if len(columns) == 0 || columns[0] != indexer.ColumnName {
+					return fmt.Errorf("the first column must be %q", indexer.ColumnName)
+				}
+				for _, column := range columns {
+					if !slices.Contains(indexer.Columns, column) {
+						return fmt.Errorf("unknown column %q, expected one of: %s", column, strings.Join(indexer.Columns, ", "))
+					}
+				}
+				return nil
+			},
+		},
+		delimiterFlag(),
+	)
+}
+
+// delimiterFlag is shared with the preview commands,
+// so that they can cut the columns off the package name
+func delimiterFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  DelimiterFlag,
+		Value: "\t",
+		Usage: `the delimiter of the columns, "\t" stands for a tab`,
+		Validator: func(delimiter string) error {
+			if delimiter == "" || strings.Contains(delimiter, " ") {
+				return errors.New("the delimiter must not be empty or contain spaces")
+			}
+			return nil
+		},
+	}
+}
+
+const (
+	ColumnsFlag   = "columns"
+	DelimiterFlag = "delimiter"
+)
+
+// printColumns are the columns of the printed packages
+type printColumns struct {
+	Columns   []string
+	Delimiter string
+}
+
+func printColumnsFlags(cmd *cli.Command) printColumns {
+	return printColumns{
+		Columns:   cmd.StringSlice(ColumnsFlag),
+		Delimiter: delimiter(cmd),
+	}
+}
+
+func delimiter(cmd *cli.Command) string {
+	return strings.ReplaceAll(cmp.Or(cmd.String(DelimiterFlag), `\t`), `\t`, "\t")
+}
+
+// names reports whether only the names are printed, so that the keys
+// file can be printed as it is, even if the index has no columns
+func (pc printColumns) names() bool {
+	return len(pc.Columns) <= 1
+}
+
+// line turns a line of the columns file into the printed line
+func (pc printColumns) line(columnsLine string) string {
+	all := indexer.SplitColumns(columnsLine)
+
+	fields := []string{}
+	for _, column := range pc.Columns {
+		fields = append(fields, all[slices.Index(indexer.Columns, column)])
+	}
+
+	return strings.Join(fields, cmp.Or(pc.Delimiter, "\t"))
 }
 
 func PrintAction(ctx context.Context, cmd *cli.Command) error {
@@ -32,39 +116,75 @@ func PrintAction(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("register fetchers: %w", err)
 	}
 
-	requested := available
-	if cmd.IsSet(IndexesFlag) {
-		flags := cmd.StringSlice(IndexesFlag)
+	requested := requestedIndexes(cmd, conf, available)
 
-		requested = slices.DeleteFunc(requested, func(index string) bool {
-			return !slices.Contains(flags, index)
-		})
-	} else {
-		requested = slices.DeleteFunc(requested, func(index string) bool {
-			builtin := slices.Contains(conf.Indexes, index)
-			_, renderDocs := conf.Experimental.RenderDocsIndexes[index]
-			_, optionsFile := conf.Experimental.OptionsFile[index]
-			return !builtin && !renderDocs && !optionsFile
-		})
+	columns := printColumnsFlags(cmd)
+
+	served, err := callDaemon(ctx, cmd, conf, daemonRequest{
+		Command:   cmd.Name,
+		Indexes:   requested,
+		Offline:   conf.Offline,
+		Columns:   columns.Columns,
+		Delimiter: columns.Delimiter,
+	})
+	if served {
+		return err
 	}
 
-	indexes, err := GetIndexes(conf.CacheDir, requested)
+	return printIndexes(ctx, Stdout, conf, requested, columns, nil)
+}
+
+// printIndexes prints keys of the requested indexes, indexing
+// them first if needed.
+//
+// If indexing is not nil, it is held while indexing, so that concurrent
+// indexing, like the daemon's refreshes, is waited for instead of repeated
+func printIndexes(
+	ctx context.Context,
+	out io.Writer,
+	conf config.Config,
+	requested []string,
+	columns printColumns,
+	indexing sync.Locker,
+) error {
+	indexes, err := GetIndexes(conf, requested)
 	if err != nil {
 		return fmt.Errorf("get indexes: %w", err)
 	}
 
-	needIndexing, err := indexer.NeedIndexing(
-		conf.CacheDir,
-		time.Duration(conf.UpdateInterval),
-		indexes,
-	)
+	needIndexing, err := printNeedIndexing(conf, indexes)
 	if err != nil {
-		return fmt.Errorf("check if indexing needed: %w", err)
+		return err
 	}
 
 	if len(needIndexing) > 0 {
 		if conf.EnableWaitingMessage {
-			PrintWaiting(Stdout)
+			PrintWaiting(out)
+		}
+
+		if indexing != nil {
+			// The waiting message is sent before
+			// blocking on the indexing running elsewhere
+			if f, ok := out.(interface{ Flush() error }); ok {
+				f.Flush()
+			}
+			indexing.Lock()
+			defer indexing.Unlock()
+
+			// The indexing waited for might have already indexed them,
+			// so they are checked again with the fresh metadata
+			names := []string{}
+			for _, index := range needIndexing {
+				names = append(names, index.Name)
+			}
+			reloaded, err := GetIndexes(conf, names)
+			if err != nil {
+				return fmt.Errorf("get indexes: %w", err)
+			}
+			needIndexing, err = printNeedIndexing(conf, reloaded)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -75,25 +195,25 @@ func PrintAction(ctx context.Context, cmd *cli.Command) error {
 			return need.Name == index.Name
 		})
 		if canPrint {
-			err = PrintIndexKeys(conf, index.Name, withPrefix)
+			err = PrintIndexKeys(out, conf, index.Name, withPrefix, columns)
 			if err != nil {
-				return fmt.Errorf("%s: %w", index, err)
+				return fmt.Errorf("%s: %w", index.Name, err)
 			}
 		}
 	}
 
-	results := indexer.RunIndexing(ctx, conf.CacheDir, needIndexing)
+	results := indexer.RunIndexing(ctx, indexingOptions(conf), needIndexing)
 	for result := range results {
 		if result.Err != nil {
 			msg := addIndexPrefix(
 				result.Index,
-				fmt.Sprintf("indexing failed: %s\n", result.Err),
+				indexingFailure(result)+"\n",
 			)
-			Stdout.Write([]byte(msg))
+			out.Write([]byte(msg))
 			continue
 		}
 
-		err := PrintIndexKeys(conf, result.Index, withPrefix)
+		err := PrintIndexKeys(out, conf, result.Index, withPrefix, columns)
 		if err != nil {
 			return fmt.Errorf("%s: %w", result.Index, err)
 		}
@@ -102,17 +222,53 @@ func PrintAction(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
-func PrintIndexKeys(conf config.Config, index string, withPrefix bool) error {
-	keys, err := indexer.OpenKeysReader(conf.CacheDir, index)
+// printNeedIndexing returns the indexes to index before printing. In
+// the offline mode, the indexes are printed as they are, even if they
+// are outdated or empty
+func printNeedIndexing(conf config.Config, indexes []indexer.Index) ([]indexer.Index, error) {
+	if conf.Offline {
+		return nil, nil
+	}
+
+	needIndexing, err := indexer.NeedIndexing(
+		conf.CacheDir,
+		time.Duration(conf.UpdateInterval),
+		indexes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("check if indexing needed: %w", err)
+	}
+
+	return needIndexing, nil
+}
+
+// maxColumnsLine is the longest line of the columns file that can be printed
+const maxColumnsLine = 1 << 20
+
+func PrintIndexKeys(out io.Writer, conf config.Config, index string, withPrefix bool, columns printColumns) error {
+	md, err := indexer.GetIndexMetadata(conf.CacheDir, index)
+	if err != nil {
+		return fmt.Errorf("get metadata: %w", err)
+	}
+
+	// The lines of the columns file start with the keys, so
+	// they are printed, and sorted, the same way as the keys
+	var keys io.ReadCloser
+	if columns.names() {
+		keys, err = indexer.OpenKeysReader(conf.CacheDir, index)
+	} else {
+		keys, err = indexer.OpenColumnsReader(conf.CacheDir, index)
+	}
 	if err != nil {
 		return fmt.Errorf("read keys file: %w", err)
 	}
 	defer keys.Close()
 
-	allkeys := []string{}
-	scanner := bufio.NewScanner(keys)
-	for scanner.Scan() {
-		allkeys = append(allkeys, scanner.Text())
+	line := func(key []byte) []byte {
+		if columns.names() {
+			return key
+		}
+		return []byte(columns.line(string(key)))
 	}
 
 	prefix := []byte{}
@@ -120,12 +276,59 @@ func PrintIndexKeys(conf config.Config, index string, withPrefix bool) error {
 		prefix = []byte(index + "/ ")
 	}
 
+	scanner := bufio.NewScanner(keys)
+	// The lines of the columns file have the descriptions,
+	// which may be longer than the default limit of the scanner
+	scanner.Buffer(nil, maxColumnsLine)
+
+	// The compact storage writes the keys already sorted,
+	// so they can be streamed without buffering
+	if md.Storage == indexer.StorageCompact {
+		for scanner.Scan() {
+			out.Write(append(prefix, line(scanner.Bytes())...))
+			out.Write([]byte{'\n'})
+		}
+		return scanner.Err()
+	}
+
+	allkeys := []string{}
+	for scanner.Scan() {
+		allkeys = append(allkeys, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
 	slices.Sort(allkeys)
 
 	for _, k := range allkeys {
-		Stdout.Write(append([]byte(prefix), []byte(k)...))
-		Stdout.Write([]byte{'\n'})
+		out.Write(append([]byte(prefix), line([]byte(k))...))
+		out.Write([]byte{'\n'})
 	}
 
 	return nil
 }
+
+// requestedIndexes filters the available indexes down to
+// those requested by the --indexes flag or, if the flag is not set,
+// to those enabled in the config
+func requestedIndexes(cmd *cli.Command, conf config.Config, available []string) []string {
+	if cmd.IsSet(IndexesFlag) {
+		flags := cmd.StringSlice(IndexesFlag)
+
+		return slices.DeleteFunc(available, func(index string) bool {
+			return !slices.Contains(flags, index)
+		})
+	}
+
+	return slices.DeleteFunc(available, func(index string) bool {
+		builtin := slices.Contains(conf.Indexes, index)
+		_, renderDocs := conf.Experimental.RenderDocsIndexes[index]
+		_, optionsFile := conf.Experimental.OptionsFile[index]
+		_, channel := conf.Experimental.Channels[index]
+		_, packagesURL := conf.Experimental.PackagesURL[index]
+		_, packagesFile := conf.Experimental.PackagesFile[index]
+		_, command := conf.Experimental.Commands[index]
+		return !builtin && !renderDocs && !optionsFile && !channel && !packagesURL && !packagesFile && !command
+	})
+}
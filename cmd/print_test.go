@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"cmp"
 	"context"
 	"encoding/json"
@@ -21,6 +22,7 @@ import (
 	"github.com/3timeslazy/nix-search-tv/indexes/indices"
 
 	"github.com/alecthomas/assert/v2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/urfave/cli/v3"
 )
 
@@ -28,7 +30,7 @@ func TestPrintInvalidFlags(t *testing.T) {
 	runPrint := func(args ...string) error {
 		cmd := cli.Command{
 			Writer: io.Discard,
-			Flags:  BaseFlags(),
+			Flags:  PrintFlags(),
 			Action: PrintAction,
 		}
 		return cmd.Run(context.TODO(), append([]string{"print"}, args...))
@@ -55,7 +57,7 @@ func TestPrintInvalidConfig(t *testing.T) {
 	runPrint := func(args ...string) error {
 		cmd := cli.Command{
 			Writer: io.Discard,
-			Flags:  BaseFlags(),
+			Flags:  PrintFlags(),
 			Action: PrintAction,
 		}
 		return cmd.Run(context.TODO(), append([]string{"print"}, args...))
@@ -268,6 +270,42 @@ func TestPrintIndexing(t *testing.T) {
 		assert.Equal(t, expected, strings.Split(output, "\n"))
 	})
 
+	t.Run("failed indexing keeps the previous index", func(t *testing.T) {
+		state := setup(t)
+
+		setNixpkgs("nix-search-tv", "fzf")
+		runPrint(t)
+		prevMd, err := indexer.GetIndexMetadata(filepath.Join(state.CacheDir, "nix-search-tv"), indices.Nixpkgs)
+		assert.NoError(t, err)
+
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &FailDownloadFetcher{},
+		})
+		setMetadata(t, state, indices.Nixpkgs, indexer.IndexMetadata{
+			CurrRelease: prevMd.CurrRelease,
+		})
+		state.Stdout.Reset()
+
+		runPrint(t)
+
+		expected := []string{
+			waitingMessage,
+			"nixpkgs/ indexing failed: download latest release: failed to download the release",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stdout.String(), "\n"))
+
+		cache := getCache(t, state)
+		assertSortEqual(t, []string{"fzf", "nix-search-tv"}, cache)
+
+		pkg, err := indexer.LoadKey(filepath.Join(state.CacheDir, "nix-search-tv"), indices.Nixpkgs, "fzf")
+		assert.NoError(t, err)
+		assert.Equal(t, "{}", string(pkg))
+
+		_, err = os.Stat(filepath.Join(state.CacheDir, "nix-search-tv", indices.Nixpkgs+".staging"))
+		assert.IsError(t, err, fs.ErrNotExist)
+	})
+
 	t.Run("need update, but not new version", func(t *testing.T) {
 
 	})
@@ -329,6 +367,38 @@ func TestPrint(t *testing.T) {
 		assertSortEqual(t, expected, output)
 	})
 
+	t.Run("compact storage", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs},
+			"experimental": map[string]any{
+				"storage": indexer.StorageCompact,
+			},
+		})
+
+		setNixpkgs(
+			"pkg-a",
+			"pkg-z",
+			"pkg-k",
+		)
+
+		printCmd(t)
+
+		cacheDir := filepath.Join(state.CacheDir, "nix-search-tv")
+		md, err := indexer.GetIndexMetadata(cacheDir, indices.Nixpkgs)
+		assert.NoError(t, err)
+		assert.Equal(t, indexer.StorageCompact, md.Storage)
+
+		// The keys are streamed in the order they are stored
+		assert.Equal(t, "pkg-a\npkg-k\npkg-z\n", state.Stdout.String())
+
+		pkg, err := indexer.LoadKey(cacheDir, indices.Nixpkgs, "pkg-k")
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(pkg))
+	})
+
 	t.Run("only nixpkgs via flag", func(t *testing.T) {
 		state := setup(t)
 
@@ -481,6 +551,271 @@ func TestParseHTML(t *testing.T) {
 	})
 }
 
+func TestParseHTMLUnchanged(t *testing.T) {
+	htmlPage := readTestdata(t, "nvf.html")
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"nvf"` {
+			wr.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		wr.Header().Set("ETag", `"nvf"`)
+		wr.Write(htmlPage)
+	}))
+	defer srv.Close()
+
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		config.UpdateIntervalTag:       "1ns",
+		"indexes":                      []string{},
+		"experimental": map[string]any{
+			"render_docs_indexes": map[string]any{
+				"nvf": srv.URL,
+			},
+		},
+	})
+
+	printCmd(t)
+	md, err := indexer.GetIndexMetadata(filepath.Join(state.CacheDir, "nix-search-tv"), "nvf")
+	assert.NoError(t, err)
+
+	indices.Reset()
+	state.Stdout.Reset()
+	printCmd(t)
+
+	assert.Equal(t, 1, downloads)
+	assert.Contains(t, state.Stdout.String(), "vim.package")
+
+	// Checked for updates, but kept the same release
+	updated, err := indexer.GetIndexMetadata(filepath.Join(state.CacheDir, "nix-search-tv"), "nvf")
+	assert.NoError(t, err)
+	assert.Equal(t, md.CurrRelease, updated.CurrRelease)
+	assert.True(t, updated.LastIndexedAt.After(md.LastIndexedAt))
+}
+
+func TestPackagesURL(t *testing.T) {
+	pkgs := &bytes.Buffer{}
+	zw, err := zstd.NewWriter(pkgs)
+	assert.NoError(t, err)
+	_, err = io.WriteString(zw, `{"packages":{"overlay-tool":{"version":"1.2.3","meta":{"description":"Internal tool"}}}}`)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(pkgs.Bytes())
+	}))
+	defer srv.Close()
+
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{},
+		"experimental": map[string]any{
+			"packages_url": map[string]string{
+				"overlay": srv.URL,
+			},
+		},
+	})
+
+	printCmd(t)
+	assert.Equal(t, "overlay-tool\n", state.Stdout.String())
+
+	md, err := indexer.GetIndexMetadata(filepath.Join(state.CacheDir, "nix-search-tv"), "overlay")
+	assert.NoError(t, err)
+	assert.Equal(t, `etag:"v1"`, md.CurrRelease)
+
+	indices.Reset()
+	state.Stdout.Reset()
+	err = runPreview(t, "--indexes", "overlay", "overlay-tool")
+	assert.NoError(t, err)
+	assert.Contains(t, state.Stdout.String(), "Internal tool")
+	assert.Contains(t, state.Stdout.String(), "1.2.3")
+}
+
+func TestPackagesFile(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	packagesPath := pwd + "/testdata/packages.json"
+
+	state := setup(t)
+	setNixpkgs("hello")
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs},
+		"experimental": map[string]any{
+			"packages_file": map[string]string{
+				"overlay": packagesPath,
+			},
+		},
+	})
+
+	printCmd(t)
+
+	expected := []string{
+		"",
+		"nixpkgs/ hello",
+		"overlay/ hello-overlay",
+		"overlay/ internal-cli",
+	}
+	output := strings.Split(state.Stdout.String(), "\n")
+	assertSortEqual(t, expected, output)
+
+	indices.Reset()
+	state.Stdout.Reset()
+	err = runPreview(t, "--indexes", "overlay", "hello-overlay")
+	assert.NoError(t, err)
+	assert.Contains(t, state.Stdout.String(), "Hello from the private overlay")
+	assert.Contains(t, state.Stdout.String(), "2.12.1")
+
+	// The overlay is not a part of nixpkgs, so there is no link to it
+	indices.Reset()
+	state.Stdout.Reset()
+	err = runSource(t, "--indexes", "overlay", "hello-overlay")
+	assert.NoError(t, err)
+	assert.Equal(t, "/nix/store/abc-overlay/pkgs/hello/default.nix", state.Stdout.String())
+
+	indices.Reset()
+	state.Stdout.Reset()
+	err = runSource(t, "--indexes", "overlay", "internal-cli")
+	assert.NoError(t, err)
+	assert.Equal(t, "", state.Stdout.String())
+}
+
+func TestPrintColumns(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	packagesPath := pwd + "/testdata/packages.json"
+
+	for _, storage := range []string{indexer.StorageBadger, indexer.StorageCompact} {
+		t.Run(storage, func(t *testing.T) {
+			state := setup(t)
+			setNixpkgs("hello")
+
+			writeXdgConfig(t, state, map[string]any{
+				config.EnableWaitingMessageTag: false,
+				"indexes":                      []string{indices.Nixpkgs},
+				"experimental": map[string]any{
+					"storage": storage,
+					"packages_file": map[string]string{
+						"overlay": packagesPath,
+					},
+				},
+			})
+
+			printCmd(t, "--columns", "name,version,description")
+
+			expected := []string{
+				"",
+				"nixpkgs/ hello\t\t",
+				"overlay/ hello-overlay\t2.12.1\tHello from the private overlay",
+				"overlay/ internal-cli\t0.4.0\tCommand line tool for the internal services",
+			}
+			output := strings.Split(state.Stdout.String(), "\n")
+			assertSortEqual(t, expected, output)
+
+			indices.Reset()
+			state.Stdout.Reset()
+			printCmd(t, "--indexes", "overlay", "--columns", "name,description", "--delimiter", "|")
+			assert.Equal(t, "hello-overlay|Hello from the private overlay\n"+
+				"internal-cli|Command line tool for the internal services\n", state.Stdout.String())
+
+			// The preview gets the whole line and must find the key in it
+			indices.Reset()
+			state.Stdout.Reset()
+			err = runPreview(t, "--indexes", "nixpkgs,overlay", "overlay/ hello-overlay\t2.12.1\tHello from the private overlay")
+			assert.NoError(t, err)
+			assert.Contains(t, state.Stdout.String(), "Hello from the private overlay")
+
+			indices.Reset()
+			state.Stdout.Reset()
+			err = runPreview(t, "--indexes", "nixpkgs,overlay", "--delimiter", "|", "overlay/ internal-cli|Command line tool for the internal services")
+			assert.NoError(t, err)
+			assert.Contains(t, state.Stdout.String(), "0.4.0")
+		})
+	}
+
+	t.Run("name is not the first column", func(t *testing.T) {
+		setup(t)
+
+		cmd := cli.Command{
+			Writer:    io.Discard,
+			ErrWriter: io.Discard,
+			Flags:     PrintFlags(),
+			Action:    PrintAction,
+		}
+		err := cmd.Run(context.TODO(), []string{"print", "--columns", "version,name"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `the first column must be "name"`)
+	})
+
+	// Longer than the default 64KB limit of bufio.Scanner
+	long := strings.Repeat("very ", 20_000) + "long"
+	for _, storage := range []string{indexer.StorageBadger, indexer.StorageCompact} {
+		t.Run("long description in "+storage, func(t *testing.T) {
+			state := setup(t)
+
+			writeXdgConfig(t, state, map[string]any{
+				config.EnableWaitingMessageTag: false,
+				"indexes":                      []string{indices.Nixpkgs},
+				"experimental": map[string]any{
+					"storage": storage,
+				},
+			})
+			indices.SetFetchers(map[string]indexer.Fetcher{
+				indices.Nixpkgs: &ContentFetcher{pkgs: map[string]string{
+					"hello": `{"meta":{"description":"` + long + `"}}`,
+				}},
+			})
+
+			printCmd(t, "--columns", "name,description")
+			assert.Equal(t, "hello\t"+long+"\n", state.Stdout.String())
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	// The plugin is shared with the tests of the fetcher
+	pluginPath := filepath.Join(pwd, "../indexes/command/testdata/plugin.sh")
+
+	state := setup(t)
+	setNixpkgs()
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{"terraform"},
+		"experimental": map[string]any{
+			"commands": map[string][]string{
+				"terraform": {"sh", pluginPath},
+			},
+		},
+	})
+
+	printCmd(t)
+
+	expected := []string{
+		"",
+		"bucket",
+		"vpc",
+	}
+	output := strings.Split(state.Stdout.String(), "\n")
+	assertSortEqual(t, expected, output)
+
+	indices.Reset()
+	state.Stdout.Reset()
+	err = runPreview(t, "--indexes", "terraform", "vpc")
+	assert.NoError(t, err)
+	assert.Contains(t, state.Stdout.String(), "Network for the services")
+	assert.Contains(t, state.Stdout.String(), "2.1.0")
+}
+
 func TestOptionsFile(t *testing.T) {
 	pwd, err := os.Getwd()
 	assert.NoError(t, err)
@@ -595,7 +930,7 @@ func TestOptionsFile(t *testing.T) {
 func printCmd(t *testing.T, args ...string) {
 	cmd := cli.Command{
 		Writer: io.Discard,
-		Flags:  BaseFlags(),
+		Flags:  PrintFlags(),
 		Action: PrintAction,
 	}
 	err := cmd.Run(context.TODO(), append([]string{"print"}, args...))
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Provides = &cli.Command{
+	Name:      "provides",
+	UsageText: "nix-search-tv provides <command>",
+	Usage:     "Print packages whose main program is the command",
+	Action:    ProvidesAction,
+	Flags:     BaseFlags(),
+}
+
+var CommandNotFound = &cli.Command{
+	Name:      "command-not-found",
+	UsageText: "nix-search-tv command-not-found <command>",
+	Usage:     "Suggest how to run a missing command. Meant to be called from the shell's command-not-found handler, so it prints to stderr and exits with 127",
+	Action:    CommandNotFoundAction,
+	Flags:     BaseFlags(),
+}
+
+func ProvidesAction(ctx context.Context, cmd *cli.Command) error {
+	conf, requested, err := providesIndexes(cmd)
+	if err != nil {
+		return err
+	}
+	withPrefix := len(requested) > 1
+
+	for _, index := range requested {
+		keys, err := indexer.ProvidesKeys(conf.CacheDir, index, cmd.Args().First())
+		if err != nil {
+			return fmt.Errorf("%s: %w", index, err)
+		}
+		printKeys(index, keys, withPrefix)
+	}
+
+	return nil
+}
+
+func CommandNotFoundAction(ctx context.Context, cmd *cli.Command) error {
+	conf, requested, err := providesIndexes(cmd)
+	if err != nil {
+		return err
+	}
+	command := cmd.Args().First()
+
+	suggestions := []string{}
+	// The indexes built before the main programs are skipped, so that
+	// the handler still suggests the packages of the other indexes
+	outdated := []string{}
+	for _, index := range requested {
+		keys, err := indexer.ProvidesKeys(conf.CacheDir, index, command)
+		if errors.Is(err, indexer.ErrNoProvides) {
+			outdated = append(outdated, index)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", index, err)
+		}
+		md, err := indexer.GetIndexMetadata(conf.CacheDir, index)
+		if err != nil {
+			return fmt.Errorf("%s: get metadata: %w", index, err)
+		}
+		for _, key := range keys {
+			suggestions = append(suggestions, suggestion(conf, md, index, key))
+		}
+	}
+
+	// The handler is expected to behave like the shell does for missing
+	// commands, so the suggestions go to stderr and the exit code is 127
+	if len(suggestions) == 0 {
+		fmt.Fprintf(Stderr, "%s: command not found\n", command)
+	} else {
+		fmt.Fprintf(Stderr, "%s: command not found. It is provided by:\n", command)
+		for _, s := range suggestions {
+			fmt.Fprintf(Stderr, "  %s\n", s)
+		}
+	}
+	if len(outdated) > 0 {
+		fmt.Fprintf(Stderr, "%s: no main programs, rebuild with `nix-search-tv index --force`\n", strings.Join(outdated, ", "))
+	}
+
+	return cli.Exit("", commandNotFoundCode)
+}
+
+// commandNotFoundCode is the exit code of the shells for missing commands
+const commandNotFoundCode = 127
+
+// providesIndexes returns the requested indexes, sorted
+// so that the builtin nixpkgs goes before the other ones
+func providesIndexes(cmd *cli.Command) (config.Config, []string, error) {
+	if cmd.Args().First() == "" {
+		return config.Config{}, nil, errors.New("command is required")
+	}
+
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return config.Config{}, nil, fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return config.Config{}, nil, fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+	slices.SortFunc(requested, func(a, b string) int {
+		if (a == indices.Nixpkgs) != (b == indices.Nixpkgs) {
+			if a == indices.Nixpkgs {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	return conf, requested, nil
+}
+
+// suggestion returns the `nix shell` command running the package. Indexes
+// without a known flake, like local packages.json files, are only named
+func suggestion(conf config.Config, md indexer.IndexMetadata, index, key string) string {
+	flake, ok := findFlake(conf, md, index)
+	if !ok {
+		return key + " (" + index + ")"
+	}
+
+	return "nix shell " + shellQuote(flake.installable(key))
+}
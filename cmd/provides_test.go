@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/urfave/cli/v3"
+)
+
+func TestProvides(t *testing.T) {
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs, indices.Nur},
+	})
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs: &ContentFetcher{pkgs: map[string]string{
+			"ripgrep":                 `{"meta":{"mainProgram":"rg"}}`,
+			"python3Packages.ripgrep": `{"meta":{"mainProgram":"rg"}}`,
+			"ugrep":                   `{"meta":{"mainProgram":"ugrep"}}`,
+		}},
+		indices.Nur: &ContentFetcher{pkgs: map[string]string{
+			"nur.repos.alice.ripgrep": `{"meta":{"mainProgram":"rg"}}`,
+		}},
+	})
+
+	printCmd(t)
+
+	t.Run("provides", func(t *testing.T) {
+		state.Stdout.Reset()
+		err := runProvides(ProvidesAction, "rg")
+		assert.NoError(t, err)
+		expected := []string{
+			"nixpkgs/ ripgrep",
+			"nixpkgs/ python3Packages.ripgrep",
+			"nur/ nur.repos.alice.ripgrep",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stdout.String(), "\n"))
+	})
+
+	t.Run("single index", func(t *testing.T) {
+		state.Stdout.Reset()
+		err := runProvides(ProvidesAction, "--indexes", indices.Nixpkgs, "ugrep")
+		assert.NoError(t, err)
+		assert.Equal(t, "ugrep\n", state.Stdout.String())
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		state.Stdout.Reset()
+		state.Stderr.Reset()
+		err := runProvides(CommandNotFoundAction, "rg")
+		assertExitCode(t, 127, err)
+		expected := []string{
+			"rg: command not found. It is provided by:",
+			"  nix shell nixpkgs#ripgrep",
+			"  nix shell nixpkgs#python3Packages.ripgrep",
+			"  nix shell github:nix-community/NUR#repos.alice.ripgrep",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stderr.String(), "\n"))
+		assert.Equal(t, "", state.Stdout.String())
+	})
+
+	t.Run("no suggestions", func(t *testing.T) {
+		state.Stderr.Reset()
+		err := runProvides(CommandNotFoundAction, "hx")
+		assertExitCode(t, 127, err)
+		assert.Equal(t, "hx: command not found\n", state.Stderr.String())
+	})
+
+	t.Run("index without main programs", func(t *testing.T) {
+		// The main programs and their marker are under the same prefix
+		dropPrefix(t, filepath.Join(state.CacheDir, "nix-search-tv", indices.Nur, indexer.StorageBadger), "\x00provides")
+
+		state.Stderr.Reset()
+		err := runProvides(CommandNotFoundAction, "rg")
+		assertExitCode(t, 127, err)
+		expected := []string{
+			"rg: command not found. It is provided by:",
+			"  nix shell nixpkgs#ripgrep",
+			"  nix shell nixpkgs#python3Packages.ripgrep",
+			"nur: no main programs, rebuild with `nix-search-tv index --force`",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stderr.String(), "\n"))
+
+		err = runProvides(ProvidesAction, "rg")
+		assert.IsError(t, err, indexer.ErrNoProvides)
+	})
+}
+
+// dropPrefix deletes the keys with the prefix from
+// the badger index, like if they were never indexed
+func dropPrefix(t *testing.T, dir, prefix string) {
+	t.Helper()
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLoggingLevel(badger.ERROR))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.NoError(t, db.DropPrefix([]byte(prefix)))
+}
+
+func runProvides(action cli.ActionFunc, args ...string) error {
+	cmd := cli.Command{
+		Writer:         io.Discard,
+		Flags:          BaseFlags(),
+		Action:         action,
+		ExitErrHandler: func(context.Context, *cli.Command, error) {},
+	}
+	return cmd.Run(context.TODO(), append([]string{"provides"}, args...))
+}
+
+func assertExitCode(t *testing.T, code int, err error) {
+	t.Helper()
+
+	var exitErr cli.ExitCoder
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, code, exitErr.ExitCode())
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Query = &cli.Command{
+	Name:      "query",
+	UsageText: "nix-search-tv query [--indexes <indexes>] [terms]",
+	Usage: "Print packages and options matching all the terms, like " +
+		"`license:mit platform:aarch64-darwin -broken unfree:false main:rg type:bool`. " +
+		"Fields: " + strings.Join(indexer.QueryFields(), ", "),
+	Action: QueryAction,
+	Flags:  BaseFlags(),
+	// The negated terms, like `-broken`, look like flags,
+	// so the flags are told apart from the terms by `queryArgs`
+	SkipFlagParsing: true,
+}
+
+func QueryAction(ctx context.Context, cmd *cli.Command) error {
+	terms, err := queryArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if cmd.Bool("help") {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	text := strings.Join(terms, " ")
+	if strings.TrimSpace(text) == "" {
+		return errors.New("query terms are required")
+	}
+
+	query, err := indexer.ParseQuery(text)
+	if err != nil {
+		return fmt.Errorf("parse query: %w", err)
+	}
+
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+	slices.Sort(requested)
+	withPrefix := len(requested) > 1
+
+	for _, index := range requested {
+		keys, err := indexer.QueryKeys(conf.CacheDir, index, query)
+		if err != nil {
+			return fmt.Errorf("%s: %w", index, err)
+		}
+		printKeys(index, keys, withPrefix)
+	}
+
+	return nil
+}
+
+// queryArgs sets the flags of the command and returns the query terms.
+// Only the arguments naming a flag of the command are flags, everything
+// else, including the negated terms, is a term. The arguments after
+// "--" are always terms
+func queryArgs(cmd *cli.Command) ([]string, error) {
+	args := cmd.Args().Slice()
+	terms := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			terms = append(terms, args[i+1:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		flag := queryFlag(cmd, name)
+		if !strings.HasPrefix(arg, "-") || flag == nil {
+			terms = append(terms, arg)
+			continue
+		}
+
+		if _, isBool := flag.(*cli.BoolFlag); isBool && !hasValue {
+			value = "true"
+		} else if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		if err := cmd.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value %q for flag %s: %w", value, arg, err)
+		}
+	}
+
+	return terms, nil
+}
+
+func queryFlag(cmd *cli.Command, name string) cli.Flag {
+	for _, flag := range cmd.Flags {
+		if slices.Contains(flag.Names(), name) {
+			return flag
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestQuery(t *testing.T) {
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs, indices.HomeManager},
+	})
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs: &ContentFetcher{pkgs: map[string]string{
+			"ripgrep":  `{"meta":{"license":{"spdxId":"MIT"},"platforms":["aarch64-darwin"],"mainProgram":"rg"}}`,
+			"ugrep":    `{"meta":{"license":{"spdxId":"BSD-3-Clause"},"platforms":["aarch64-darwin"]}}`,
+			"old-grep": `{"meta":{"license":{"spdxId":"MIT"},"platforms":["aarch64-darwin"],"broken":true}}`,
+		}},
+		indices.HomeManager: &ContentFetcher{pkgs: map[string]string{
+			"programs.ripgrep.enable":    `{"type":"boolean"}`,
+			"programs.ripgrep.arguments": `{"type":"list of string"}`,
+		}},
+	})
+
+	printCmd(t)
+
+	t.Run("packages", func(t *testing.T) {
+		state.Stdout.Reset()
+		queryCmd(t, "license:mit", "platform:aarch64-darwin", "-broken")
+		assert.Equal(t, "nixpkgs/ ripgrep\n", state.Stdout.String())
+	})
+
+	t.Run("options", func(t *testing.T) {
+		state.Stdout.Reset()
+		queryCmd(t, "--indexes", indices.HomeManager, "ripgrep type:bool")
+		assert.Equal(t, "programs.ripgrep.enable\n", state.Stdout.String())
+	})
+
+	t.Run("flags between terms", func(t *testing.T) {
+		state.Stdout.Reset()
+		queryCmd(t, "-broken", "--indexes", indices.Nixpkgs, "--offline", "grep")
+		assert.Equal(t, "ripgrep\nugrep\n", state.Stdout.String())
+	})
+
+	t.Run("both", func(t *testing.T) {
+		state.Stdout.Reset()
+		queryCmd(t, "grep", "-license:bsd-3-clause", "-broken")
+		expected := []string{
+			"home-manager/ programs.ripgrep.arguments",
+			"home-manager/ programs.ripgrep.enable",
+			"nixpkgs/ ripgrep",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stdout.String(), "\n"))
+	})
+
+	t.Run("unindexed index", func(t *testing.T) {
+		state.Stdout.Reset()
+		queryCmd(t, "--indexes", indices.Nur, "--offline", "grep")
+		assert.Equal(t, "", state.Stdout.String())
+
+		// Querying the index must not leave an empty list of its packages
+		_, err := os.Stat(filepath.Join(state.CacheDir, "nix-search-tv", indices.Nur, "cache.txt"))
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+}
+
+func queryCmd(t *testing.T, args ...string) {
+	cmd := cli.Command{
+		Writer:          io.Discard,
+		Flags:           BaseFlags(),
+		Action:          QueryAction,
+		SkipFlagParsing: true,
+	}
+	err := cmd.Run(context.TODO(), append([]string{"query"}, args...))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Search = &cli.Command{
+	Name:      "search",
+	UsageText: "nix-search-tv search [words]",
+	Usage:     "Print packages matching the words by name first, then by description",
+	Action:    SearchAction,
+	Flags:     BaseFlags(),
+}
+
+func SearchAction(ctx context.Context, cmd *cli.Command) error {
+	query := strings.Join(cmd.Args().Slice(), " ")
+	if strings.TrimSpace(query) == "" {
+		return errors.New("search words are required")
+	}
+
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+	withPrefix := len(requested) > 1
+
+	results := make([]indexer.SearchResult, len(requested))
+	for i, index := range requested {
+		results[i], err = indexer.SearchKeys(conf.CacheDir, index, query)
+		if err != nil {
+			return fmt.Errorf("%s: %w", index, err)
+		}
+	}
+
+	// Print name matches of all indexes first, because
+	// they are more relevant than any description match
+	for i, index := range requested {
+		printKeys(index, results[i].Names, withPrefix)
+	}
+	for i, index := range requested {
+		printKeys(index, results[i].Descriptions, withPrefix)
+	}
+
+	return nil
+}
+
+func printKeys(index string, keys []string, withPrefix bool) {
+	for _, key := range keys {
+		if withPrefix {
+			key = addIndexPrefix(index, key)
+		}
+		Stdout.Write([]byte(key + "\n"))
+	}
+}
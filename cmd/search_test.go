@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestSearch(t *testing.T) {
+	setPackages := func() {
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &ContentFetcher{pkgs: map[string]string{
+				"alacritty":         `{"meta":{"description":"Cross-platform, GPU-accelerated terminal emulator"}}`,
+				"kitty":             `{"meta":{"description":"Modern, hackable, featureful, OpenGL based terminal emulator"}}`,
+				"tmux":              `{"meta":{"description":"Terminal multiplexer"}}`,
+				"terminal-emulator": `{"meta":{"description":"Not a real package"}}`,
+			}},
+			indices.HomeManager: &ContentFetcher{pkgs: map[string]string{
+				"programs.kitty.enable": `{"description":"<p>Whether to enable Kitty terminal emulator.</p>"}`,
+			}},
+		})
+	}
+
+	t.Run("names first, then descriptions", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs},
+		})
+		setPackages()
+
+		printCmd(t)
+		state.Stdout.Reset()
+
+		searchCmd(t, "terminal", "emulator")
+
+		expected := []string{
+			"terminal-emulator",
+			"kitty",
+			"alacritty",
+			"",
+		}
+		assert.Equal(t, expected, strings.Split(state.Stdout.String(), "\n"))
+	})
+
+	t.Run("multiple indexes", func(t *testing.T) {
+		state := setup(t)
+
+		writeXdgConfig(t, state, map[string]any{
+			config.EnableWaitingMessageTag: false,
+			"indexes":                      []string{indices.Nixpkgs, indices.HomeManager},
+		})
+		setPackages()
+
+		printCmd(t)
+		state.Stdout.Reset()
+
+		searchCmd(t, "kitty")
+
+		// Both are name matches, and the indexes
+		// are not printed in any particular order
+		expected := []string{
+			"nixpkgs/ kitty",
+			"home-manager/ programs.kitty.enable",
+			"",
+		}
+		assertSortEqual(t, expected, strings.Split(state.Stdout.String(), "\n"))
+	})
+}
+
+func searchCmd(t *testing.T, args ...string) {
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  BaseFlags(),
+		Action: SearchAction,
+	}
+	err := cmd.Run(context.TODO(), append([]string{"search"}, args...))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixreleases"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Snippet = &cli.Command{
+	Name:      "snippet",
+	UsageText: "nix-search-tv snippet [--style nixos|home-manager|shell|run|installable|flake-input] [package_name]",
+	Usage:     "Print a snippet installing the package, or setting the option",
+	Action:    SnippetAction,
+	Flags:     SnippetFlags(),
+}
+
+func SnippetFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.StringFlag{
+			Name:  StyleFlag,
+			Value: StyleNixOS,
+			Usage: "the snippet style: nixos, home-manager, shell, run, installable or flake-input",
+			Validator: func(style string) error {
+				if !slices.Contains(styles, style) {
+					return fmt.Errorf("unknown style %q, expected one of: %s", style, strings.Join(styles, ", "))
+				}
+				return nil
+			},
+		},
+		delimiterFlag(),
+	)
+}
+
+const StyleFlag = "style"
+
+const (
+	StyleNixOS       = "nixos"
+	StyleHomeManager = "home-manager"
+	StyleShell       = "shell"
+	StyleRun         = "run"
+	// StyleInstallable prints only the installable, like `nixpkgs#hello`,
+	// so that scripts can pass it as a single argument to `nix`
+	StyleInstallable = "installable"
+	StyleFlakeInput  = "flake-input"
+)
+
+var styles = []string{StyleNixOS, StyleHomeManager, StyleShell, StyleRun, StyleInstallable, StyleFlakeInput}
+
+func SnippetAction(ctx context.Context, cmd *cli.Command) error {
+	fullPkgName := strings.Join(cmd.Args().Slice(), " ")
+	if fullPkgName == "" {
+		return errors.New("package name is required")
+	}
+	fullPkgName, _, _ = strings.Cut(fullPkgName, delimiter(cmd))
+
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	if cmd.IsSet(IndexesFlag) {
+		conf.Indexes = cmd.StringSlice(IndexesFlag)
+	}
+
+	_, err = SetupIndexes(conf)
+	if err != nil {
+		return err
+	}
+
+	style := cmd.String(StyleFlag)
+	snippet := func(index string, out io.Writer, pkg json.RawMessage) error {
+		return writeSnippet(out, conf, style, index, pkg)
+	}
+
+	// Snippets are not shown in fuzzy finders, so
+	// there is no waiting banner, only the error
+	return previewPackage(Stdout, conf, indexer.LoadKey, snippet, nil, fullPkgName)
+}
+
+func writeSnippet(out io.Writer, conf config.Config, style, index string, pkg json.RawMessage) error {
+	info, err := indices.GetInfo(index, pkg)
+	if err != nil {
+		return err
+	}
+
+	md, err := indexer.GetIndexMetadata(conf.CacheDir, index)
+	if err != nil {
+		return fmt.Errorf("get metadata: %w", err)
+	}
+
+	var snippet string
+	if isOptionsIndex(conf, index) {
+		snippet, err = optionSnippet(info, style)
+	} else {
+		snippet, err = packageSnippet(conf, md, info, style, index)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, snippet)
+	return err
+}
+
+// isOptionsIndex tells the indexes of options from the indexes of packages
+func isOptionsIndex(conf config.Config, index string) bool {
+	switch index {
+	case indices.NixOS, indices.HomeManager, indices.Darwin:
+		return true
+	}
+
+	if channel, ok := conf.Experimental.Channels[index]; ok {
+		return channel.Type == indices.NixOS
+	}
+	_, renderDocs := conf.Experimental.RenderDocsIndexes[index]
+	_, optionsFile := conf.Experimental.OptionsFile[index]
+
+	return renderDocs || optionsFile
+}
+
+func packageSnippet(conf config.Config, md indexer.IndexMetadata, info pkginfo.Info, style, index string) (string, error) {
+	switch style {
+	case StyleNixOS:
+		return "environment.systemPackages = [ pkgs." + nixAttrPath(info.Name) + " ];", nil
+	case StyleHomeManager:
+		return "home.packages = [ pkgs." + nixAttrPath(info.Name) + " ];", nil
+	}
+
+	flake, ok := findFlake(conf, md, index)
+	if !ok {
+		return "", fmt.Errorf("no flake is known for the %q index", index)
+	}
+
+	switch style {
+	case StyleShell:
+		return "nix shell " + shellQuote(flake.installable(info.Name)), nil
+	case StyleRun:
+		return "nix run " + shellQuote(flake.installable(info.Name)), nil
+	case StyleInstallable:
+		return flake.installable(info.Name), nil
+	case StyleFlakeInput:
+		return fmt.Sprintf("inputs.%s.url = %q;", flake.input, flake.url), nil
+	}
+
+	return "", fmt.Errorf("unknown style %q", style)
+}
+
+func optionSnippet(info pkginfo.Info, style string) (string, error) {
+	if style != StyleNixOS && style != StyleHomeManager {
+		return "", fmt.Errorf("the %q style is only for packages, options support %q and %q", style, StyleNixOS, StyleHomeManager)
+	}
+
+	return info.Name + " = " + optionValue(info) + ";", nil
+}
+
+// optionValue picks the value of the option snippet. Booleans are set
+// to the opposite of their default, as setting the default is pointless.
+// Other options prefer the example, then the default, then an empty
+// value of their type
+func optionValue(info pkginfo.Info) string {
+	example := strings.TrimSpace(info.Example)
+	def := strings.TrimSpace(info.Default)
+
+	switch {
+	case info.Type == "boolean":
+		if def == "true" {
+			return "false"
+		}
+		return "true"
+	case example != "":
+		return example
+	case def != "":
+		return def
+	case strings.HasPrefix(info.Type, "string"):
+		return `""`
+	case strings.HasPrefix(info.Type, "list of"):
+		return "[ ]"
+	case strings.HasPrefix(info.Type, "attribute set"):
+		return "{ }"
+	case strings.Contains(info.Type, "integer"):
+		return "0"
+	}
+
+	return "null"
+}
+
+var reNixIdent = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_'-]*$`)
+
+// nixAttrPath quotes the parts of the package name that
+// are not valid nix identifiers, like `"7zz"`
+func nixAttrPath(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !reNixIdent.MatchString(part) {
+			parts[i] = `"` + part + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+var reShellSafe = regexp.MustCompile(`^[a-zA-Z0-9_./:#+@=-]+$`)
+
+// shellQuote quotes the word for POSIX shells, unless it
+// consists only of characters the shells do not interpret
+func shellQuote(word string) string {
+	if reShellSafe.MatchString(word) {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// packageFlake is the flake a package index is built from
+type packageFlake struct {
+	// input is the conventional name of the flake input
+	input string
+	url   string
+	// ref refers to the flake on the command line, like `nixpkgs#hello`
+	ref string
+	// keyPrefix is cut off from the package names, as the
+	// flake outputs do not have it
+	keyPrefix string
+}
+
+func (f packageFlake) installable(key string) string {
+	return f.ref + "#" + strings.TrimPrefix(key, f.keyPrefix)
+}
+
+// findFlake returns the flake of the index. The nixpkgs indexes point
+// at the revision they are pinned to, or at the channel they are built
+// from. Indexes without a known flake, like local packages.json files,
+// return false
+func findFlake(conf config.Config, md indexer.IndexMetadata, index string) (packageFlake, bool) {
+	switch index {
+	case indices.Nixpkgs:
+		if revision := pinnedRevision(md); revision != "" {
+			return nixpkgsFlake(index, revision), true
+		}
+		// The `nixpkgs` flake of the global registry is nixpkgs-unstable too
+		flake := nixpkgsFlake(index, nixreleases.NixpkgsUnstable)
+		flake.ref = "nixpkgs"
+		return flake, true
+	case indices.Nur:
+		return packageFlake{
+			input:     "nur",
+			url:       "github:nix-community/NUR",
+			ref:       "github:nix-community/NUR",
+			keyPrefix: "nur.",
+		}, true
+	}
+
+	if channel, ok := conf.Experimental.Channels[index]; ok && channel.Type == indices.Nixpkgs {
+		return nixpkgsFlake(index, cmp.Or(pinnedRevision(md), channel.Channel)), true
+	}
+
+	return packageFlake{}, false
+}
+
+func nixpkgsFlake(input, ref string) packageFlake {
+	url := "github:NixOS/nixpkgs/" + ref
+	return packageFlake{input: input, url: url, ref: url}
+}
+
+// pinnedRevision returns the git revision of the pinned release. Pins by
+// release only know the short revision the release name ends with
+func pinnedRevision(md indexer.IndexMetadata) string {
+	if md.Pin.IsZero() {
+		return ""
+	}
+	if md.Pin.Revision != "" {
+		return md.Pin.Revision
+	}
+
+	return md.CurrRelease[strings.LastIndexByte(md.CurrRelease, '.')+1:]
+}
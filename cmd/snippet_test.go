@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestSnippet(t *testing.T) {
+	state := setup(t)
+
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{},
+		"experimental": map[string]any{
+			"channels": map[string]any{
+				"stable": map[string]string{
+					"type":    indices.Nixpkgs,
+					"channel": "nixos-24.11",
+				},
+			},
+			"options_file": map[string]string{
+				"file": pwd + "/testdata/options.json",
+			},
+		},
+	})
+
+	// The channel is indexed beforehand, so
+	// that the real fetcher is never called
+	results := indexer.RunIndexing(context.TODO(), indexer.Options{
+		CacheDir: filepath.Join(state.CacheDir, "nix-search-tv"),
+	}, []indexer.Index{{
+		Name: "stable",
+		Fetcher: &ContentFetcher{pkgs: map[string]string{
+			"ripgrep":             `{"meta":{"mainProgram":"rg"}}`,
+			"evil$(touch x);'rm'": `{"meta":{}}`,
+		}},
+	}})
+	for result := range results {
+		assert.NoError(t, result.Err)
+	}
+	printCmd(t, "--indexes", "file")
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"stable/ ripgrep"}, "environment.systemPackages = [ pkgs.ripgrep ];\n"},
+		{[]string{"--style", StyleHomeManager, "stable/ ripgrep"}, "home.packages = [ pkgs.ripgrep ];\n"},
+		{[]string{"--style", StyleShell, "stable/ ripgrep"}, "nix shell github:NixOS/nixpkgs/nixos-24.11#ripgrep\n"},
+		{[]string{"--style", StyleRun, "stable/ ripgrep"}, "nix run github:NixOS/nixpkgs/nixos-24.11#ripgrep\n"},
+		{[]string{"--style", StyleInstallable, "stable/ ripgrep"}, "github:NixOS/nixpkgs/nixos-24.11#ripgrep\n"},
+		{[]string{"--style", StyleShell, "stable/ evil$(touch x);'rm'"}, "nix shell 'github:NixOS/nixpkgs/nixos-24.11#evil$(touch x);'\\''rm'\\'''\n"},
+		{[]string{"--style", StyleInstallable, "stable/ evil$(touch x);'rm'"}, "github:NixOS/nixpkgs/nixos-24.11#evil$(touch x);'rm'\n"},
+		{[]string{"--style", StyleFlakeInput, "stable/ ripgrep"}, "inputs.stable.url = \"github:NixOS/nixpkgs/nixos-24.11\";\n"},
+		{[]string{"file/ age.ageBin"}, "age.ageBin = \"${pkgs.age}/bin/age\";\n"},
+	}
+	for _, test := range tests {
+		indices.Reset()
+		state.Stdout.Reset()
+		err := snippetCmd(append([]string{"--indexes", "stable,file"}, test.args...)...)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, state.Stdout.String())
+	}
+
+	t.Run("packages only styles", func(t *testing.T) {
+		indices.Reset()
+		err := snippetCmd("--indexes", "file", "--style", StyleShell, "age.ageBin")
+		assert.EqualError(t, err, `the "shell" style is only for packages, options support "nixos" and "home-manager"`)
+	})
+}
+
+func TestPackageSnippet(t *testing.T) {
+	revision := "95ea544c84ebed84a31896b0ecea2570e5e0e236"
+	byRevision := indexer.IndexMetadata{
+		CurrRelease: "nixpkgs-25.05pre747523.95ea544c84eb",
+		Pin:         indexer.Pin{Revision: revision},
+	}
+	byRelease := indexer.IndexMetadata{
+		CurrRelease: "nixpkgs-25.05pre747523.95ea544c84eb",
+		Pin:         indexer.Pin{Release: "nixpkgs-25.05pre747523.95ea544c84eb"},
+	}
+
+	tests := []struct {
+		index    string
+		md       indexer.IndexMetadata
+		name     string
+		style    string
+		expected string
+	}{
+		{indices.Nixpkgs, indexer.IndexMetadata{}, "ripgrep", StyleShell, "nix shell nixpkgs#ripgrep"},
+		{indices.Nixpkgs, indexer.IndexMetadata{}, "ripgrep", StyleInstallable, "nixpkgs#ripgrep"},
+		{indices.Nixpkgs, indexer.IndexMetadata{}, "ripgrep", StyleFlakeInput, `inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixpkgs-unstable";`},
+		{indices.Nixpkgs, byRevision, "ripgrep", StyleShell, "nix shell github:NixOS/nixpkgs/" + revision + "#ripgrep"},
+		{indices.Nixpkgs, byRevision, "ripgrep", StyleFlakeInput, `inputs.nixpkgs.url = "github:NixOS/nixpkgs/` + revision + `";`},
+		{indices.Nixpkgs, byRelease, "ripgrep", StyleRun, "nix run github:NixOS/nixpkgs/95ea544c84eb#ripgrep"},
+		{indices.Nixpkgs, indexer.IndexMetadata{}, "python3Packages.7zip", StyleNixOS, `environment.systemPackages = [ pkgs.python3Packages."7zip" ];`},
+		{indices.Nixpkgs, indexer.IndexMetadata{}, "a b", StyleShell, `nix shell 'nixpkgs#a b'`},
+		{indices.Nur, indexer.IndexMetadata{}, "nur.repos.alice.ripgrep", StyleNixOS, "environment.systemPackages = [ pkgs.nur.repos.alice.ripgrep ];"},
+		{indices.Nur, indexer.IndexMetadata{}, "nur.repos.alice.ripgrep", StyleRun, "nix run github:nix-community/NUR#repos.alice.ripgrep"},
+	}
+	for _, test := range tests {
+		snippet, err := packageSnippet(config.Config{}, test.md, pkginfo.Info{Name: test.name}, test.style, test.index)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, snippet)
+	}
+
+	_, err := packageSnippet(config.Config{}, indexer.IndexMetadata{}, pkginfo.Info{Name: "hello"}, StyleShell, "overlay")
+	assert.EqualError(t, err, `no flake is known for the "overlay" index`)
+}
+
+func TestOptionValue(t *testing.T) {
+	tests := []struct {
+		info     pkginfo.Info
+		expected string
+	}{
+		{pkginfo.Info{Type: "boolean", Default: "false"}, "true"},
+		{pkginfo.Info{Type: "boolean", Default: "true\n"}, "false"},
+		{pkginfo.Info{Type: "boolean"}, "true"},
+		{pkginfo.Info{Type: "string", Default: `"main"`, Example: `"master"`}, `"master"`},
+		{pkginfo.Info{Type: "null or string", Default: "null"}, "null"},
+		{pkginfo.Info{Type: "string"}, `""`},
+		{pkginfo.Info{Type: "list of string"}, "[ ]"},
+		{pkginfo.Info{Type: "attribute set of string"}, "{ }"},
+		{pkginfo.Info{Type: "signed integer"}, "0"},
+		{pkginfo.Info{Type: "package"}, "null"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, optionValue(test.info))
+	}
+}
+
+func snippetCmd(args ...string) error {
+	cmd := cli.Command{
+		Writer:    io.Discard,
+		ErrWriter: io.Discard,
+		Flags:     SnippetFlags(),
+		Action:    SnippetAction,
+	}
+	return cmd.Run(context.TODO(), append([]string{"snippet"}, args...))
+}
@@ -1,14 +1,13 @@
 package cmd
 
 import (
-	"github.com/3timeslazy/nix-search-tv/indexes/indices"
 	"github.com/urfave/cli/v3"
 )
 
 var Source = &cli.Command{
 	Name:      "source",
-	UsageText: "nix-search-tv source [package_name]",
+	UsageText: "nix-search-tv source [--format ansi|plain|json|markdown] [package_name]",
 	Usage:     "Print the link to the package's nix declaration",
-	Action:    NewPreviewAction(indices.SourcePreview),
-	Flags:     BaseFlags(),
+	Action:    NewPreviewAction(sourcePreviews, nil),
+	Flags:     PreviewFlags(),
 }
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Status = &cli.Command{
+	Name:      "status",
+	UsageText: "nix-search-tv status [--json]",
+	Usage:     "Print the release, age, size and the last indexing attempt of every index",
+	Action:    StatusAction,
+	Flags:     StatusFlags(),
+}
+
+func StatusFlags() []cli.Flag {
+	return append(
+		BaseFlags(),
+		&cli.BoolFlag{
+			Name:  JSONFlag,
+			Usage: "print the status as json",
+		},
+	)
+}
+
+const JSONFlag = "json"
+
+type indexStatus struct {
+	Index         string    `json:"index"`
+	Release       string    `json:"release"`
+	Pin           string    `json:"pin,omitempty"`
+	Storage       string    `json:"storage"`
+	LastIndexedAt time.Time `json:"last_indexed_at"`
+	NeedIndexing  bool      `json:"need_indexing"`
+	Packages      int       `json:"packages"`
+	SizeBytes     int64     `json:"size_bytes"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	LastDuration  string    `json:"last_duration"`
+	LastError     string    `json:"last_error"`
+}
+
+func StatusAction(ctx context.Context, cmd *cli.Command) error {
+	conf, err := GetConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("get config: %w", err)
+	}
+
+	available, err := SetupIndexes(conf)
+	if err != nil {
+		return fmt.Errorf("register fetchers: %w", err)
+	}
+	requested := requestedIndexes(cmd, conf, available)
+	slices.Sort(requested)
+
+	indexes, err := GetIndexes(conf, requested)
+	if err != nil {
+		return fmt.Errorf("get indexes: %w", err)
+	}
+
+	statuses := []indexStatus{}
+	for _, index := range indexes {
+		needIndexing, err := indexer.NeedIndexing(
+			conf.CacheDir,
+			time.Duration(conf.UpdateInterval),
+			[]indexer.Index{index},
+		)
+		if err != nil {
+			return fmt.Errorf("%s: check if indexing needed: %w", index.Name, err)
+		}
+
+		size, err := indexer.IndexSize(conf.CacheDir, index.Name)
+		if err != nil {
+			return fmt.Errorf("%s: get size: %w", index.Name, err)
+		}
+
+		md := index.Metadata
+		statuses = append(statuses, indexStatus{
+			Index:         index.Name,
+			Release:       md.CurrRelease,
+			Pin:           cmp.Or(index.Pin.Release, index.Pin.Revision),
+			Storage:       cmp.Or(md.Storage, indexer.StorageBadger),
+			LastIndexedAt: md.LastIndexedAt,
+			NeedIndexing:  len(needIndexing) > 0,
+			Packages:      md.Packages,
+			SizeBytes:     size,
+			LastAttemptAt: md.LastAttemptAt,
+			LastDuration:  md.LastDuration.Round(time.Millisecond).String(),
+			LastError:     md.LastError,
+		})
+	}
+
+	if cmd.Bool(JSONFlag) {
+		enc := json.NewEncoder(Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Fprintln(Stdout)
+		}
+		printStatus(Stdout, status)
+	}
+
+	return nil
+}
+
+func printStatus(out io.Writer, status indexStatus) {
+	fmt.Fprintln(out, status.Index)
+
+	if status.Release == "" {
+		fmt.Fprintln(out, "  release:        not indexed")
+	} else {
+		fmt.Fprintf(out, "  release:        %s\n", status.Release)
+		fmt.Fprintf(out, "  indexed at:     %s (%s ago)\n", formatTime(status.LastIndexedAt), formatAge(status.LastIndexedAt))
+		fmt.Fprintf(out, "  packages:       %d\n", status.Packages)
+		fmt.Fprintf(out, "  size:           %s (%s)\n", formatSize(status.SizeBytes), status.Storage)
+	}
+
+	if status.Pin != "" {
+		fmt.Fprintf(out, "  pinned to:      %s\n", status.Pin)
+	}
+
+	needIndexing := "no"
+	if status.NeedIndexing {
+		needIndexing = "yes"
+	}
+	fmt.Fprintf(out, "  needs indexing: %s\n", needIndexing)
+
+	if !status.LastAttemptAt.IsZero() {
+		result := "succeeded"
+		if status.LastError != "" {
+			result = "failed"
+		}
+		fmt.Fprintf(out, "  last attempt:   %s, %s in %s\n", formatTime(status.LastAttemptAt), result, status.LastDuration)
+	}
+	if status.LastError != "" {
+		fmt.Fprintf(out, "  last error:     %s\n", status.LastError)
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.DateTime)
+}
+
+func formatAge(t time.Time) string {
+	return time.Since(t).Round(time.Minute).String()
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
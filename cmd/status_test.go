@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/indices"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/urfave/cli/v3"
+)
+
+func TestStatus(t *testing.T) {
+	state := setup(t)
+
+	writeXdgConfig(t, state, map[string]any{
+		config.EnableWaitingMessageTag: false,
+		"indexes":                      []string{indices.Nixpkgs, indices.HomeManager},
+	})
+
+	indices.SetFetchers(map[string]indexer.Fetcher{
+		indices.Nixpkgs:     &PkgsFetcher{[]string{"fzf", "tv"}},
+		indices.HomeManager: &FailFetcher{},
+	})
+	printCmd(t)
+
+	t.Run("json", func(t *testing.T) {
+		state.Stdout.Reset()
+
+		statusCmd(t, "--json")
+
+		statuses := []indexStatus{}
+		err := json.Unmarshal(state.Stdout.Bytes(), &statuses)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(statuses))
+
+		hm, nixpkgs := statuses[0], statuses[1]
+		assert.Equal(t, indices.Nixpkgs, nixpkgs.Index)
+		assert.Equal(t, "latest", nixpkgs.Release)
+		assert.Equal(t, 2, nixpkgs.Packages)
+		assert.False(t, nixpkgs.NeedIndexing)
+		assert.True(t, nixpkgs.SizeBytes > 0)
+		assert.False(t, nixpkgs.LastAttemptAt.IsZero())
+		assert.Zero(t, nixpkgs.LastError)
+
+		assert.Equal(t, indices.HomeManager, hm.Index)
+		assert.Zero(t, hm.Release)
+		assert.True(t, hm.NeedIndexing)
+		assert.False(t, hm.LastAttemptAt.IsZero())
+		assert.Equal(t, "get latest release: failed to get latest release", hm.LastError)
+	})
+
+	t.Run("failure keeps the current release", func(t *testing.T) {
+		indices.SetFetchers(map[string]indexer.Fetcher{
+			indices.Nixpkgs: &FailDownloadFetcher{},
+		})
+		setMetadata(t, state, indices.Nixpkgs, indexer.IndexMetadata{
+			CurrRelease: "previous",
+			Packages:    2,
+		})
+		printCmd(t, "--indexes", indices.Nixpkgs)
+		state.Stdout.Reset()
+
+		statusCmd(t, "--indexes", indices.Nixpkgs)
+
+		output := state.Stdout.String()
+		assert.Contains(t, output, "release:        previous\n")
+		assert.Contains(t, output, "packages:       2\n")
+		assert.Contains(t, output, "needs indexing: yes\n")
+		assert.Contains(t, output, "last error:     download latest release: failed to download the release\n")
+		assert.True(t, strings.HasPrefix(output, indices.Nixpkgs+"\n"))
+	})
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "300.0 MiB", formatSize(300<<20))
+}
+
+func statusCmd(t *testing.T, args ...string) {
+	cmd := cli.Command{
+		Writer: io.Discard,
+		Flags:  StatusFlags(),
+		Action: StatusAction,
+	}
+	err := cmd.Run(context.TODO(), append([]string{"status"}, args...))
+	assert.NoError(t, err)
+}
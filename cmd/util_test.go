@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -20,6 +21,7 @@ type state struct {
 	CacheDir  string
 	ConfigDir string
 	Stdout    *bytes.Buffer
+	Stderr    *bytes.Buffer
 }
 
 func setup(t *testing.T) state {
@@ -35,6 +37,8 @@ func setup(t *testing.T) state {
 
 	buf := bytes.NewBuffer(nil)
 	Stdout = buf
+	errBuf := bytes.NewBuffer(nil)
+	Stderr = errBuf
 
 	indices.Reset()
 
@@ -50,6 +54,7 @@ func setup(t *testing.T) state {
 		assert.NoError(t, err)
 
 		Stdout = nil
+		Stderr = os.Stderr
 
 		indices.Reset()
 	})
@@ -58,6 +63,7 @@ func setup(t *testing.T) state {
 		CacheDir:  cacheDir,
 		ConfigDir: configDir,
 		Stdout:    buf,
+		Stderr:    errBuf,
 	}
 }
 
@@ -107,6 +113,30 @@ func (f *FailFetcher) DownloadRelease(ctx context.Context, release string) (io.R
 	return nil, errors.New("failed to download the release")
 }
 
+// FailDownloadFetcher finds a new release, but
+// fails to download it
+type FailDownloadFetcher struct{}
+
+func (f *FailDownloadFetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return "broken", nil
+}
+
+func (f *FailDownloadFetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	return nil, errors.New("failed to download the release")
+}
+
+// TransientFetcher finds a new release, but the
+// server is unavailable to download it
+type TransientFetcher struct{}
+
+func (f *TransientFetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return "unavailable", nil
+}
+
+func (f *TransientFetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	return nil, &indexer.TransientError{Err: errors.New("expected http 200, but 503")}
+}
+
 type PkgsFetcher struct {
 	pkgs []string
 }
@@ -128,3 +158,47 @@ func (f *PkgsFetcher) DownloadRelease(ctx context.Context, release string) (io.R
 
 	return io.NopCloser(bytes.NewBuffer(data)), nil
 }
+
+// ContentFetcher is like PkgsFetcher, but also
+// sets packages' content
+type ContentFetcher struct {
+	pkgs    map[string]string
+	release string
+}
+
+func (f *ContentFetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return cmp.Or(f.release, "latest"), nil
+}
+
+func (f *ContentFetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	pkgs := indexer.Indexable{Packages: map[string]json.RawMessage{}}
+	for name, content := range f.pkgs {
+		pkgs.Packages[name] = []byte(content)
+	}
+
+	data, err := json.Marshal(pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewBuffer(data)), nil
+}
+
+// ReleasesFetcher serves a package named after every release,
+// and can be pinned to any of them
+type ReleasesFetcher struct {
+	latest string
+}
+
+func (f *ReleasesFetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return f.latest, nil
+}
+
+func (f *ReleasesFetcher) ResolveRevision(ctx context.Context, revision string) (string, error) {
+	return "nixpkgs-25.05pre1." + revision[:12], nil
+}
+
+func (f *ReleasesFetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	data := `{"packages":{"` + release + `":{}}}`
+	return io.NopCloser(strings.NewReader(data)), nil
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/3timeslazy/nix-search-tv/config"
+	"github.com/3timeslazy/nix-search-tv/indexer"
 	"github.com/3timeslazy/nix-search-tv/style"
 )
 
@@ -50,6 +52,16 @@ func PreviewWaiting(out io.Writer, conf config.Config) {
 		"Looking for packages updates... It shouldn't take more than a few seconds.",
 		"Next time, this message won't be here until the next indexing",
 		"",
+	}
+
+	// The progress is only a nice-to-have, so the
+	// message is printed even if it cannot be read
+	progress, _ := indexer.ReadProgress(conf.CacheDir)
+	if len(progress) > 0 {
+		s = append(s, progressTable(progress), "")
+	}
+
+	s = append(s,
 		"Indexing happens in two cases:",
 		"  - It's the first run of the program",
 		fmt.Sprintf("  - It's been more than %s since the last indexing", time.Duration(conf.UpdateInterval).String()),
@@ -61,8 +73,31 @@ func PreviewWaiting(out io.Writer, conf config.Config) {
 		"  https://github.com/3timeslazy/nix-search-tv",
 		"",
 		"Thank you for using nix-search-tv!",
-	}
+	)
 
 	msg := strings.Join(s, "\n")
 	out.Write([]byte(msg))
 }
+
+// progressTable renders the phase, the downloaded part of the
+// release and the number of indexed packages of every index
+func progressTable(progress []indexer.Progress) string {
+	buf := &strings.Builder{}
+	tw := tabwriter.NewWriter(buf, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(tw, "  index\tphase\tdownloaded\tpackages")
+	for _, p := range progress {
+		downloaded := ""
+		switch {
+		case p.Percent() >= 0:
+			downloaded = fmt.Sprintf("%d%% of %s", p.Percent(), formatSize(p.Total))
+		case p.Downloaded > 0:
+			downloaded = formatSize(p.Downloaded)
+		}
+
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%d\n", p.Index, p.Phase, downloaded, p.Packages)
+	}
+	tw.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
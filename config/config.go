@@ -17,24 +17,98 @@ import (
 // Config represents configuration options stored in the
 // config file
 type Config struct {
-	UpdateInterval       Duration     `json:"update_interval"`
-	CacheDir             string       `json:"cache_dir"`
-	EnableWaitingMessage bool         `json:"enable_waiting_message"`
-	Indexes              []string     `json:"indexes"`
-	Experimental         Experimental `json:"experimental"`
+	UpdateInterval       Duration       `json:"update_interval"`
+	CacheDir             string         `json:"cache_dir"`
+	EnableWaitingMessage bool           `json:"enable_waiting_message"`
+	Indexes              []string       `json:"indexes"`
+	KeepReleases         int            `json:"keep_releases"`
+	Pins                 map[string]Pin `json:"pins"`
+	Releases             Releases       `json:"releases"`
+	HTTP                 HTTP           `json:"http"`
+	Experimental         Experimental   `json:"experimental"`
+
+	// PreviewTemplates maps the index names to the text/template
+	// templates replacing their default previews
+	PreviewTemplates map[string]string `json:"preview_templates"`
+
+	// Offline disables the indexing, so that only
+	// the already indexed packages are served. It is
+	// set by the --offline flag
+	Offline bool `json:"-"`
 }
 
 type config struct {
-	UpdateInterval       *Duration    `json:"update_interval"`
-	CacheDir             *string      `json:"cache_dir"`
-	EnableWaitingMessage *bool        `json:"enable_waiting_message"`
-	Indexes              *[]string    `json:"indexes"`
-	Experimental         Experimental `json:"experimental"`
+	UpdateInterval       *Duration      `json:"update_interval"`
+	CacheDir             *string        `json:"cache_dir"`
+	EnableWaitingMessage *bool          `json:"enable_waiting_message"`
+	Indexes              *[]string      `json:"indexes"`
+	KeepReleases         *int           `json:"keep_releases"`
+	Pins                 map[string]Pin `json:"pins"`
+	Releases             *Releases      `json:"releases"`
+	HTTP                 httpConfig     `json:"http"`
+	Experimental         Experimental   `json:"experimental"`
+
+	PreviewTemplates map[string]string `json:"preview_templates"`
+}
+
+// Pin fixes an index to a single release. Either the exact
+// release, or the git revision it is built from is expected
+type Pin struct {
+	Release  string `json:"release"`
+	Revision string `json:"revision"`
+}
+
+// Channel is an additional nixpkgs or NixOS index
+// built from a channel other than the unstable one
+type Channel struct {
+	// Type is either "nixpkgs" for packages or "nixos" for options
+	Type string `json:"type"`
+	// Channel is the name of the channel, like "nixos-24.11"
+	Channel string `json:"channel"`
+}
+
+// Releases overrides where the nixpkgs and NixOS releases are looked
+// up and downloaded from. Empty values mean the official endpoints
+type Releases struct {
+	// ListURL is the S3 bucket with the releases
+	ListURL string `json:"list_url"`
+	// DownloadURL serves the files of the releases
+	DownloadURL string `json:"download_url"`
+	// ChannelsURL serves the git revisions of the channels
+	ChannelsURL string `json:"channels_url"`
+}
+
+// HTTP configures the requests of all indexes
+type HTTP struct {
+	// Timeout is how long to wait for a response, or
+	// for the next part of a download, before giving up
+	Timeout Duration `json:"timeout"`
+	// Retries is how many times a request is retried
+	// after a timeout or an error of the server
+	Retries int `json:"retries"`
+}
+
+type httpConfig struct {
+	Timeout *Duration `json:"timeout"`
+	Retries *int      `json:"retries"`
 }
 
 type Experimental struct {
-	RenderDocsIndexes map[string]string `json:"render_docs_indexes"`
-	OptionsFile       map[string]string `json:"options_file"`
+	RenderDocsIndexes map[string]string  `json:"render_docs_indexes"`
+	OptionsFile       map[string]string  `json:"options_file"`
+	Channels          map[string]Channel `json:"channels"`
+	// PackagesURL maps the index names to the urls of packages.json
+	// files in the nixpkgs format, optionally compressed
+	PackagesURL map[string]string `json:"packages_url"`
+	// PackagesFile maps the index names to the paths of packages.json
+	// files in the nixpkgs format, like `nix-env -qa --json --meta` prints
+	PackagesFile map[string]string `json:"packages_file"`
+	// Commands maps the index names to the external programs, with
+	// their arguments, fetching the packages. See `indexes/command`
+	Commands map[string][]string `json:"commands"`
+	// Storage is the kind of the on-disk storage of the
+	// indexes, either "badger" (default) or "compact"
+	Storage string `json:"storage"`
 }
 
 // Keep the constants below in sync with the `Config` json tags
@@ -93,6 +167,24 @@ func mergeDefaults(loaded config) Config {
 	if loaded.Indexes != nil {
 		conf.Indexes = *loaded.Indexes
 	}
+	if loaded.KeepReleases != nil {
+		conf.KeepReleases = *loaded.KeepReleases
+	}
+	if loaded.Pins != nil {
+		conf.Pins = loaded.Pins
+	}
+	if loaded.PreviewTemplates != nil {
+		conf.PreviewTemplates = loaded.PreviewTemplates
+	}
+	if loaded.Releases != nil {
+		conf.Releases = *loaded.Releases
+	}
+	if loaded.HTTP.Timeout != nil {
+		conf.HTTP.Timeout = *loaded.HTTP.Timeout
+	}
+	if loaded.HTTP.Retries != nil {
+		conf.HTTP.Retries = *loaded.HTTP.Retries
+	}
 	if loaded.EnableWaitingMessage != nil {
 		conf.EnableWaitingMessage = *loaded.EnableWaitingMessage
 	}
@@ -100,6 +192,11 @@ func mergeDefaults(loaded config) Config {
 	conf.Experimental = Experimental{
 		RenderDocsIndexes: loaded.Experimental.RenderDocsIndexes,
 		OptionsFile:       loaded.Experimental.OptionsFile,
+		Channels:          loaded.Experimental.Channels,
+		PackagesURL:       loaded.Experimental.PackagesURL,
+		PackagesFile:      loaded.Experimental.PackagesFile,
+		Commands:          loaded.Experimental.Commands,
+		Storage:           loaded.Experimental.Storage,
 	}
 
 	return conf
@@ -127,6 +224,10 @@ func defaults() Config {
 		CacheDir:             cacheDir,
 		EnableWaitingMessage: true,
 		Indexes:              indexes,
+		HTTP: HTTP{
+			Timeout: Duration(30 * time.Second),
+			Retries: 3,
+		},
 	}
 }
 
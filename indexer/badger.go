@@ -3,10 +3,12 @@ package indexer
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 
-	"github.com/3timeslazy/nix-search-tv/indexer/jsonstream"
 	"github.com/dgraph-io/badger/v4"
 )
 
@@ -17,13 +19,34 @@ type Badger struct {
 type BadgerConfig struct {
 	Dir      string
 	InMemory bool
+
+	// ReadOnly opens an existing index without taking badger's directory
+	// lock, so any number of processes can read the index at the same time.
+	//
+	// It is safe, because an index is never modified once it is built. New
+	// releases are indexed into a separate directory. See `runIndex`
+	ReadOnly bool
 }
 
+var (
+	ErrNotFound   = errors.New("key not found")
+	ErrNotIndexed = errors.New("index is not built yet")
+)
+
 func NewBadger(conf BadgerConfig) (*Badger, error) {
+	if conf.ReadOnly {
+		_, err := os.Stat(conf.Dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotIndexed
+		}
+	}
+
 	opts := badger.
 		DefaultOptions(conf.Dir).
 		WithLoggingLevel(badger.ERROR).
-		WithInMemory(conf.InMemory)
+		WithInMemory(conf.InMemory).
+		WithReadOnly(conf.ReadOnly).
+		WithBypassLockGuard(conf.ReadOnly)
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, fmt.Errorf("open badger: %w", err)
@@ -46,33 +69,16 @@ type Indexable struct {
 	Packages map[string]json.RawMessage `json:"packages"`
 }
 
-func (indexer *Badger) Index(data io.Reader, indexedKeys io.Writer) error {
-	// Delete previous index. If we do not do that
-	// and just re-assign the keys below, the index
-	// will be updated, however its size will increase drastically.
-	// Then, to keep the index size small, we'll need to deal with
-	// badger's garbade colletion. So, it's just easier to drop everything
-	err := indexer.badger.DropAll()
-	if err != nil {
-		return fmt.Errorf("drop all: %w", err)
-	}
-
+func (indexer *Badger) Index(data io.Reader, indexedKeys io.Writer, columns io.Writer) error {
+	// There's no need to drop the previous keys here, because
+	// new releases are always indexed into an empty directory. See `runIndex`
 	batch := indexer.badger.NewWriteBatch()
 
-	err = jsonstream.ParsePackages(data, func(name string, content []byte) error {
-		nameb := []byte(name)
-
-		err := batch.Set(nameb, bytes.Clone(content))
-		if err != nil {
-			return fmt.Errorf("set %s: %w", name, err)
-		}
-
-		indexedKeys.Write(append(nameb, []byte("\n")...))
-
-		return nil
+	err := indexPackages(data, indexedKeys, columns, func(key, value []byte) error {
+		return batch.Set(key, bytes.Clone(value))
 	})
 	if err != nil {
-		return fmt.Errorf("handle packages: %w", err)
+		return err
 	}
 
 	return batch.Flush()
@@ -94,6 +100,9 @@ func (bdg *Badger) Load(pkgName string) (json.RawMessage, error) {
 
 		return nil
 	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, pkgName)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("iter failed: %w", err)
 	}
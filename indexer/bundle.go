@@ -0,0 +1,314 @@
+package indexer
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A bundle is a zstd-compressed tar archive with the current releases of
+// some indexes. Every file of an index is stored under the index name, and
+// the manifest goes last, so that the bundle can be written and read in one pass
+const (
+	bundleManifest        = "manifest.json"
+	bundleManifestVersion = 1
+)
+
+// BundleManifest describes the content of a bundle
+type BundleManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Indexes   []string  `json:"indexes"`
+	// Files maps the paths of the files in the
+	// bundle to the sha256 sums of their content
+	Files map[string]string `json:"files"`
+}
+
+// ExportBundle writes the current releases of the indexes into the bundle
+func ExportBundle(w io.Writer, cacheDir string, indexes []string) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("create encoder: %w", err)
+	}
+	tw := tar.NewWriter(zw)
+
+	manifest := BundleManifest{
+		Version:   bundleManifestVersion,
+		CreatedAt: time.Now(),
+		Indexes:   indexes,
+		Files:     map[string]string{},
+	}
+
+	for _, index := range indexes {
+		md, err := GetIndexMetadata(cacheDir, index)
+		if err != nil {
+			return fmt.Errorf("%s: get metadata: %w", index, err)
+		}
+		if md.CurrRelease == "" {
+			return fmt.Errorf("%s: %w", index, ErrNotIndexed)
+		}
+
+		err = exportIndex(tw, cacheDir, index, manifest.Files)
+		if err != nil {
+			return fmt.Errorf("%s: %w", index, err)
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	err = writeTarFile(tw, bundleManifest, data)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return zw.Close()
+}
+
+func exportIndex(tw *tar.Writer, cacheDir, index string, sums map[string]string) error {
+	indexDir := filepath.Join(cacheDir, index)
+
+	return filepath.WalkDir(indexDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(indexDir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(index, filepath.ToSlash(rel))
+
+		sum, err := exportFile(tw, name, p)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", rel, err)
+		}
+		sums[name] = sum
+
+		return nil
+	})
+}
+
+// exportFile copies the file into the archive, as the
+// storage files are too big to be read into memory
+func exportFile(tw *tar.Writer, name, p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     stat.Size(),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(tw, io.TeeReader(file, hash)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
+
+// ImportBundle replaces the indexes with the releases from the bundle. The
+// files are checked against the manifest, and none of the indexes is
+// replaced if the bundle is corrupted. Only the known indexes are
+// imported. It returns the imported indexes
+func ImportBundle(r io.Reader, opts Options, known []string) ([]string, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("create decoder: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+
+	// The bundle is extracted into a directory of its own first. Unlike
+	// the staging directories of `runIndex`, it is not shared with
+	// the indexing, so that neither of them removes the other's files.
+	// It is in the cache directory, so that the indexes can be renamed
+	importDir, err := os.MkdirTemp(opts.CacheDir, ".import-*")
+	if err != nil {
+		return nil, fmt.Errorf("create import directory: %w", err)
+	}
+	defer os.RemoveAll(importDir)
+
+	staged := map[string]bool{}
+
+	var manifest *BundleManifest
+	sums := map[string]string{}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+
+		if hdr.Name == bundleManifest {
+			manifest = &BundleManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("decode manifest: %w", err)
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+
+		index, rel, ok := splitBundlePath(hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("invalid path %s", hdr.Name)
+		}
+		if !slices.Contains(known, index) {
+			return nil, fmt.Errorf("unknown index %s", index)
+		}
+		staged[index] = true
+
+		sum, err := extractFile(tr, filepath.Join(importDir, index, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+		sums[hdr.Name] = sum
+	}
+
+	if manifest == nil {
+		return nil, errors.New("bundle has no manifest")
+	}
+	if manifest.Version != bundleManifestVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+	if !maps.Equal(manifest.Files, sums) {
+		return nil, errors.New("bundle content does not match the manifest")
+	}
+	for index := range staged {
+		if !slices.Contains(manifest.Indexes, index) {
+			return nil, fmt.Errorf("index %s is not in the manifest", index)
+		}
+	}
+
+	// All the staged indexes are known, so are the manifest ones then
+	for _, index := range manifest.Indexes {
+		if !staged[index] {
+			return nil, fmt.Errorf("index %s is missing from the bundle", index)
+		}
+	}
+
+	for _, index := range manifest.Indexes {
+		stagingDir := filepath.Join(importDir, index)
+		md, err := GetIndexMetadata(importDir, index)
+		if err != nil {
+			return nil, fmt.Errorf("%s: get metadata: %w", index, err)
+		}
+		// The imported index replaces the current one, so the
+		// processes keeping it open have to notice, like after indexing
+		md.BuildID = newBuildID()
+		if err = setIndexMetadata(stagingDir, md); err != nil {
+			return nil, fmt.Errorf("%s: set metadata: %w", index, err)
+		}
+
+		current, err := GetIndexMetadata(opts.CacheDir, index)
+		if err != nil {
+			return nil, fmt.Errorf("%s: get metadata: %w", index, err)
+		}
+		archive := ""
+		if opts.KeepReleases > 0 && current.CurrRelease != "" && current.CurrRelease != md.CurrRelease {
+			archive = archiveDir(opts.CacheDir, index, current.CurrRelease)
+		}
+
+		err = swapDirs(stagingDir, filepath.Join(opts.CacheDir, index), archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: replace index: %w", index, err)
+		}
+
+		_ = pruneHistory(opts.CacheDir, index, opts.KeepReleases)
+	}
+
+	return manifest.Indexes, nil
+}
+
+// splitBundlePath splits the path of a file in the bundle into the index
+// name and the path inside the index. It rejects the paths that could
+// escape the index directory
+func splitBundlePath(name string) (string, string, bool) {
+	if name != path.Clean(name) || path.IsAbs(name) || strings.Contains(name, `\`) {
+		return "", "", false
+	}
+
+	index, rel, ok := strings.Cut(name, "/")
+	if !ok || index == "" || index == "." || index == ".." || strings.HasPrefix(rel, "../") {
+		return "", "", false
+	}
+
+	return index, rel, true
+}
+
+func extractFile(r io.Reader, dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(file, io.TeeReader(r, hash)); err != nil {
+		return "", err
+	}
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
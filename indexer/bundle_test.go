@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestImportBundle(t *testing.T) {
+	exported := t.TempDir()
+	err := setIndexMetadata(filepath.Join(exported, "nixpkgs"), IndexMetadata{CurrRelease: "exported"})
+	assert.NoError(t, err)
+
+	bundle := bytes.Buffer{}
+	err = ExportBundle(&bundle, exported, []string{"nixpkgs"})
+	assert.NoError(t, err)
+
+	known := []string{"nixpkgs", "nur"}
+
+	t.Run("valid bundle", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		imported, err := ImportBundle(bytes.NewReader(bundle.Bytes()), Options{CacheDir: cacheDir}, known)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"nixpkgs"}, imported)
+
+		md, err := GetIndexMetadata(cacheDir, "nixpkgs")
+		assert.NoError(t, err)
+		assert.Equal(t, "exported", md.CurrRelease)
+
+		// Nothing but the index is left in the cache directory
+		entries, err := os.ReadDir(cacheDir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+	})
+
+	t.Run("does not touch the staging directory", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		staging := filepath.Join(cacheDir, "nixpkgs"+stagingSuffix, "file")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(staging), 0755))
+		assert.NoError(t, os.WriteFile(staging, []byte("indexing"), 0666))
+
+		_, err := ImportBundle(bytes.NewReader(bundle.Bytes()), Options{CacheDir: cacheDir}, known)
+		assert.NoError(t, err)
+
+		data, err := os.ReadFile(staging)
+		assert.NoError(t, err)
+		assert.Equal(t, "indexing", string(data))
+	})
+
+	t.Run("content does not match the manifest", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		err := setIndexMetadata(filepath.Join(cacheDir, "nixpkgs"), IndexMetadata{CurrRelease: "current"})
+		assert.NoError(t, err)
+
+		manifest := BundleManifest{
+			Version: bundleManifestVersion,
+			Indexes: []string{"nixpkgs"},
+			Files:   map[string]string{"nixpkgs/metadata.json": "not a real sum"},
+		}
+		corrupted := writeBundle(t, map[string]string{
+			"nixpkgs/metadata.json": `{"curr_release":"corrupted"}`,
+		}, manifest)
+
+		_, err = ImportBundle(corrupted, Options{CacheDir: cacheDir}, known)
+		assert.EqualError(t, err, "bundle content does not match the manifest")
+
+		// The current index is left as it is
+		md, err := GetIndexMetadata(cacheDir, "nixpkgs")
+		assert.NoError(t, err)
+		assert.Equal(t, "current", md.CurrRelease)
+		assert.False(t, IsIndexing(cacheDir, "nixpkgs"))
+	})
+
+	t.Run("paths escaping the index", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		corrupted := writeBundle(t, map[string]string{
+			"nixpkgs/../../escaped": "",
+		}, BundleManifest{})
+
+		_, err := ImportBundle(corrupted, Options{CacheDir: cacheDir}, known)
+		assert.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "invalid path"))
+	})
+
+	t.Run("unknown indexes", func(t *testing.T) {
+		for _, name := range []string{"home/metadata.json", `..\escaped/metadata.json`} {
+			cacheDir := t.TempDir()
+			corrupted := writeBundle(t, map[string]string{name: "{}"}, BundleManifest{})
+
+			_, err := ImportBundle(corrupted, Options{CacheDir: cacheDir}, known)
+			assert.Error(t, err)
+		}
+
+		_, err := ImportBundle(
+			writeBundle(t, map[string]string{"home/metadata.json": "{}"}, BundleManifest{}),
+			Options{CacheDir: t.TempDir()},
+			known,
+		)
+		assert.EqualError(t, err, "unknown index home")
+	})
+}
+
+func writeBundle(t *testing.T, files map[string]string, manifest BundleManifest) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	zw, err := zstd.NewWriter(buf)
+	assert.NoError(t, err)
+	tw := tar.NewWriter(zw)
+
+	for name, content := range files {
+		assert.NoError(t, writeTarFile(tw, name, []byte(content)))
+	}
+
+	data, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	assert.NoError(t, writeTarFile(tw, bundleManifest, data))
+
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, zw.Close())
+
+	return buf
+}
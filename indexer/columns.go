@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// columnsFile keeps the package names with the precomputed
+// extra columns, one package per line, separated by tabs.
+// See `columnsLine`
+const columnsFile = "columns.txt"
+
+const (
+	ColumnName        = "name"
+	ColumnVersion     = "version"
+	ColumnDescription = "description"
+)
+
+// Columns are all the columns, in the order they are kept in the columns file
+var Columns = []string{ColumnName, ColumnVersion, ColumnDescription}
+
+// ErrNoColumns is returned for indexes built before the
+// columns were introduced. They have to be indexed again
+var ErrNoColumns = errors.New("the index has no columns, rebuild it with `nix-search-tv index --force`")
+
+// columnar contains the fields of a package printed as columns.
+// Like `searchable`, it covers both packages and options
+type columnar struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Meta        struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"meta"`
+}
+
+// columnsLine returns the line of the columns file for the package.
+// Malformed packages are not an error, their columns are just empty
+func columnsLine(name string, content []byte) string {
+	pkg := columnar{}
+	json.Unmarshal(content, &pkg)
+
+	// Same as `nixpkgs.Package.GetVersion`
+	version := pkg.Version
+	if version == "" {
+		version = strings.TrimPrefix(pkg.Meta.Name, name+"-")
+	}
+
+	desc := pkg.Meta.Description
+	if desc == "" {
+		// Options descriptions may span several paragraphs, so
+		// only the first one makes it into the column
+		desc, _, _ = strings.Cut(strings.TrimSpace(pkg.Description), "\n\n")
+		desc = reHTMLTag.ReplaceAllString(desc, "")
+	}
+
+	return name + "\t" + oneLine(version) + "\t" + oneLine(desc)
+}
+
+// oneLine collapses all the whitespace, including tabs
+// and newlines, so that the text fits into a column
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// SplitColumns splits a line of the columns file into the
+// columns, so that `Columns[i]` is the name of i-th column
+func SplitColumns(line string) []string {
+	columns := strings.SplitN(line, "\t", len(Columns))
+	for len(columns) < len(Columns) {
+		columns = append(columns, "")
+	}
+	return columns
+}
+
+func ColumnsWriter(dir string) (io.WriteCloser, error) {
+	cpath, err := initFile(dir, columnsFile, nil)
+	if err != nil {
+		return nil, fmt.Errorf("init columns: %w", err)
+	}
+
+	return os.OpenFile(cpath, os.O_WRONLY|os.O_TRUNC, 0666)
+}
+
+// OpenColumnsReader opens the columns file of the current index
+func OpenColumnsReader(cacheDir, index string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(cacheDir, index, columnsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoColumns
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open columns: %w", err)
+	}
+
+	return file, nil
+}
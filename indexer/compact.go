@@ -0,0 +1,428 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compact is an immutable storage built for fast lookups. It consists
+// of two files:
+//
+//   - index: the sorted keys and the locations of their values
+//   - values: the values, compressed in blocks of about `compactBlockSize` bytes
+//
+// Both files are memory-mapped, so opening the storage costs almost nothing,
+// and a lookup is a binary search over the keys plus one block decompression.
+//
+// The index file layout, all numbers are little-endian:
+//
+//	| magic (8 bytes) | keys count (4 bytes) | blocks count (4 bytes) |
+//	| blocks: offset (8 bytes), length (4 bytes) | ...
+//	| entries: key offset, key length, block, value offset, value length (4 bytes each) | ...
+//	| keys |
+type Compact struct {
+	dir string
+
+	index, values []byte
+	unmap         []func() error
+
+	count   int
+	blocks  []byte
+	entries []byte
+	keys    []byte
+
+	dec *zstd.Decoder
+
+	mu         sync.Mutex
+	cachedIdx  int
+	cachedData []byte
+}
+
+type CompactConfig struct {
+	Dir string
+
+	// ReadOnly opens an existing storage. Otherwise,
+	// the storage is expected to be filled by `Index`
+	ReadOnly bool
+}
+
+const (
+	compactMagic      = "NSTVCMP1"
+	compactIndexFile  = "index"
+	compactValuesFile = "values"
+	// compactColumnsFile keeps the columns while indexing,
+	// until the keys are sorted and the columns can be written
+	compactColumnsFile = "columns.tmp"
+	compactBlockSize   = 64 << 10
+
+	compactHeaderSize = 16
+	compactBlockEntry = 12
+	compactKeyEntry   = 20
+)
+
+func NewCompact(conf CompactConfig) (*Compact, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("create decoder: %w", err)
+	}
+
+	c := &Compact{
+		dir:       conf.Dir,
+		dec:       dec,
+		cachedIdx: -1,
+	}
+
+	if !conf.ReadOnly {
+		if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+			dec.Close()
+			return nil, fmt.Errorf("create directory: %w", err)
+		}
+		return c, nil
+	}
+
+	if err := c.open(); err != nil {
+		dec.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Compact) open() (err error) {
+	indexPath := filepath.Join(c.dir, compactIndexFile)
+	if _, err := os.Stat(indexPath); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotIndexed
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.unmapFiles())
+		}
+	}()
+
+	index, unmap, err := mmapFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("map index: %w", err)
+	}
+	c.unmap = append(c.unmap, unmap)
+
+	values, unmap, err := mmapFile(filepath.Join(c.dir, compactValuesFile))
+	if err != nil {
+		return fmt.Errorf("map values: %w", err)
+	}
+	c.unmap = append(c.unmap, unmap)
+
+	if len(index) < compactHeaderSize || string(index[:8]) != compactMagic {
+		return errors.New("invalid index file")
+	}
+	count := int(binary.LittleEndian.Uint32(index[8:]))
+	blocks := int(binary.LittleEndian.Uint32(index[12:]))
+
+	entriesStart := compactHeaderSize + blocks*compactBlockEntry
+	keysStart := entriesStart + count*compactKeyEntry
+	if len(index) < keysStart {
+		return errors.New("index file is truncated")
+	}
+
+	c.index = index
+	c.values = values
+	c.count = count
+	c.blocks = index[compactHeaderSize:entriesStart]
+	c.entries = index[entriesStart:keysStart]
+	c.keys = index[keysStart:]
+
+	return nil
+}
+
+func (c *Compact) Index(data io.Reader, indexedKeys io.Writer, columns io.Writer) error {
+	valuesFile, err := os.Create(filepath.Join(c.dir, compactValuesFile))
+	if err != nil {
+		return fmt.Errorf("create values file: %w", err)
+	}
+	defer valuesFile.Close()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return fmt.Errorf("create encoder: %w", err)
+	}
+	defer enc.Close()
+
+	// The keys and the columns are written once they are sorted below,
+	// so that the both files can be printed without sorting. Until then,
+	// the columns are kept in a file, and the entries point into it
+	columnsPath := filepath.Join(c.dir, compactColumnsFile)
+	columnsFile, err := os.Create(columnsPath)
+	if err != nil {
+		return fmt.Errorf("create columns file: %w", err)
+	}
+	defer os.Remove(columnsPath)
+	defer columnsFile.Close()
+
+	w := &compactWriter{
+		values:  bufio.NewWriter(valuesFile),
+		columns: &offsetWriter{w: bufio.NewWriter(columnsFile)},
+		enc:     enc,
+	}
+
+	err = indexPackages(data, io.Discard, w.columns, w.set)
+	if err != nil {
+		return err
+	}
+	if err = w.flush(); err != nil {
+		return fmt.Errorf("flush values: %w", err)
+	}
+	if err = valuesFile.Close(); err != nil {
+		return fmt.Errorf("close values file: %w", err)
+	}
+	if err = w.columns.w.Flush(); err != nil {
+		return fmt.Errorf("flush columns: %w", err)
+	}
+	if err = columnsFile.Close(); err != nil {
+		return fmt.Errorf("close columns file: %w", err)
+	}
+
+	// If a key is set more than once, the last value wins
+	slices.SortStableFunc(w.entries, func(a, b compactEntry) int {
+		return strings.Compare(a.key, b.key)
+	})
+	deduped := w.entries[:0]
+	for i, entry := range w.entries {
+		if i+1 < len(w.entries) && w.entries[i+1].key == entry.key {
+			continue
+		}
+		deduped = append(deduped, entry)
+	}
+	w.entries = deduped
+
+	err = w.writeIndex(filepath.Join(c.dir, compactIndexFile))
+	if err != nil {
+		return fmt.Errorf("write index file: %w", err)
+	}
+
+	unsortedColumns, unmap, err := mmapFile(columnsPath)
+	if err != nil {
+		return fmt.Errorf("map columns: %w", err)
+	}
+	defer unmap()
+
+	// As the duplicated keys are dropped above, the
+	// last columns of a package win, as the values do
+	for _, entry := range w.entries {
+		if strings.HasPrefix(entry.key, "\x00") {
+			continue
+		}
+		line := unsortedColumns[entry.columns:]
+		line = line[:bytes.IndexByte(line, '\n')+1]
+
+		indexedKeys.Write([]byte(entry.key + "\n"))
+		columns.Write(line)
+	}
+
+	return c.open()
+}
+
+func (c *Compact) Load(key string) (json.RawMessage, error) {
+	keyb := []byte(key)
+	i, found := sort.Find(c.count, func(i int) int {
+		return bytes.Compare(keyb, c.key(i))
+	})
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	entry := c.entries[i*compactKeyEntry:]
+	block := int(binary.LittleEndian.Uint32(entry[8:]))
+	offset := binary.LittleEndian.Uint32(entry[12:])
+	length := binary.LittleEndian.Uint32(entry[16:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := c.block(block)
+	if err != nil {
+		return nil, fmt.Errorf("read block %d: %w", block, err)
+	}
+	if int(offset+length) > len(data) {
+		return nil, fmt.Errorf("value of %s is out of its block", key)
+	}
+
+	return bytes.Clone(data[offset : offset+length]), nil
+}
+
+func (c *Compact) key(i int) []byte {
+	entry := c.entries[i*compactKeyEntry:]
+	offset := binary.LittleEndian.Uint32(entry)
+	length := binary.LittleEndian.Uint32(entry[4:])
+	return c.keys[offset : offset+length]
+}
+
+// block returns the decompressed block. The last decompressed block is
+// cached, because the keys stored next to each other are often loaded together
+func (c *Compact) block(i int) ([]byte, error) {
+	if i == c.cachedIdx {
+		return c.cachedData, nil
+	}
+
+	entry := c.blocks[i*compactBlockEntry:]
+	offset := binary.LittleEndian.Uint64(entry)
+	length := uint64(binary.LittleEndian.Uint32(entry[8:]))
+	if offset+length > uint64(len(c.values)) {
+		return nil, errors.New("block is out of the values file")
+	}
+
+	data, err := c.dec.DecodeAll(c.values[offset:offset+length], c.cachedData[:0])
+	if err != nil {
+		c.cachedIdx = -1
+		return nil, err
+	}
+
+	c.cachedIdx = i
+	c.cachedData = data
+
+	return data, nil
+}
+
+func (c *Compact) Close() error {
+	c.dec.Close()
+	return c.unmapFiles()
+}
+
+func (c *Compact) unmapFiles() error {
+	var errs []error
+	for _, unmap := range c.unmap {
+		errs = append(errs, unmap())
+	}
+	c.unmap = nil
+
+	return errors.Join(errs...)
+}
+
+type compactEntry struct {
+	key    string
+	block  uint32
+	offset uint32
+	length uint32
+	// columns is the offset of the package columns in the columns file
+	columns uint64
+}
+
+type compactBlock struct {
+	offset uint64
+	length uint32
+}
+
+type compactWriter struct {
+	values  *bufio.Writer
+	columns *offsetWriter
+	enc     *zstd.Encoder
+
+	block   []byte
+	offset  uint64
+	blocks  []compactBlock
+	entries []compactEntry
+}
+
+func (w *compactWriter) set(key, value []byte) error {
+	w.entries = append(w.entries, compactEntry{
+		key:     string(key),
+		block:   uint32(len(w.blocks)),
+		offset:  uint32(len(w.block)),
+		length:  uint32(len(value)),
+		columns: w.columns.offset,
+	})
+	w.block = append(w.block, value...)
+
+	if len(w.block) >= compactBlockSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *compactWriter) flush() error {
+	if len(w.block) > 0 {
+		compressed := w.enc.EncodeAll(w.block, nil)
+		if _, err := w.values.Write(compressed); err != nil {
+			return err
+		}
+
+		w.blocks = append(w.blocks, compactBlock{
+			offset: w.offset,
+			length: uint32(len(compressed)),
+		})
+		w.offset += uint64(len(compressed))
+		w.block = w.block[:0]
+	}
+
+	return w.values.Flush()
+}
+
+func (w *compactWriter) writeIndex(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	le := binary.LittleEndian
+	out := bufio.NewWriter(file)
+	buf := make([]byte, 0, compactKeyEntry)
+
+	buf = append(buf, compactMagic...)
+	buf = le.AppendUint32(buf, uint32(len(w.entries)))
+	buf = le.AppendUint32(buf, uint32(len(w.blocks)))
+	out.Write(buf)
+
+	for _, block := range w.blocks {
+		buf = le.AppendUint64(buf[:0], block.offset)
+		buf = le.AppendUint32(buf, block.length)
+		out.Write(buf)
+	}
+
+	keyOffset := 0
+	for _, entry := range w.entries {
+		buf = le.AppendUint32(buf[:0], uint32(keyOffset))
+		buf = le.AppendUint32(buf, uint32(len(entry.key)))
+		buf = le.AppendUint32(buf, entry.block)
+		buf = le.AppendUint32(buf, entry.offset)
+		buf = le.AppendUint32(buf, entry.length)
+		out.Write(buf)
+		keyOffset += len(entry.key)
+	}
+
+	for _, entry := range w.entries {
+		out.WriteString(entry.key)
+	}
+
+	// The write errors are kept by the bufio.Writer until the flush
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// offsetWriter counts the bytes written, so that
+// the entries know where their columns start
+type offsetWriter struct {
+	w      *bufio.Writer
+	offset uint64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.offset += uint64(n)
+	return n, err
+}
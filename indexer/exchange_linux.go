@@ -0,0 +1,13 @@
+//go:build linux
+
+package indexer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// exchangeDirs atomically swaps the two directories, so
+// that neither of the paths is missing at any moment
+func exchangeDirs(a, b string) error {
+	return unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package indexer
+
+import (
+	"errors"
+)
+
+// exchangeDirs is not supported on the platforms other than linux,
+// so the directories are swapped by two renames. See `swapDirs`
+func exchangeDirs(a, b string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// historySuffix is appended to the index name to get the directory
+// keeping its previous releases. Every release there is a complete
+// index directory, named after the escaped release
+const historySuffix = ".history"
+
+// Release is a snapshot of an index, either
+// the current one or one kept in the history
+type Release struct {
+	Metadata IndexMetadata
+	Current  bool
+
+	// The release is opened the same way as an
+	// index named `name` in the `dir` cache directory
+	dir, name string
+}
+
+func (r Release) Name() string {
+	return r.Metadata.CurrRelease
+}
+
+func (r Release) Open() (Storage, error) {
+	return OpenIndex(r.dir, r.name)
+}
+
+// Keys returns the names of all packages in the release
+func (r Release) Keys() ([]string, error) {
+	return readKeys(r.dir, r.name)
+}
+
+// ListReleases returns the releases of the index from the oldest
+// to the newest. The current release, if there is one, goes last
+func ListReleases(cacheDir, index string) ([]Release, error) {
+	releases := []Release{}
+
+	historyDir := filepath.Join(cacheDir, index+historySuffix)
+	entries, err := os.ReadDir(historyDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		md, err := GetIndexMetadata(historyDir, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("get metadata of %s: %w", entry.Name(), err)
+		}
+
+		releases = append(releases, Release{
+			Metadata: md,
+			dir:      historyDir,
+			name:     entry.Name(),
+		})
+	}
+
+	// The releases are moved to the history when they get replaced, so
+	// the last time they were checked for updates tells their order
+	slices.SortFunc(releases, func(a, b Release) int {
+		return a.Metadata.LastIndexedAt.Compare(b.Metadata.LastIndexedAt)
+	})
+
+	md, err := GetIndexMetadata(cacheDir, index)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata: %w", err)
+	}
+	if md.CurrRelease != "" {
+		releases = append(releases, Release{
+			Metadata: md,
+			Current:  true,
+			dir:      cacheDir,
+			name:     index,
+		})
+	}
+
+	return releases, nil
+}
+
+// archiveDir returns the directory the release
+// is kept in once it is replaced by a newer one
+func archiveDir(cacheDir, index, release string) string {
+	return filepath.Join(cacheDir, index+historySuffix, url.PathEscape(release))
+}
+
+// pruneHistory removes all but the `keep` newest releases from the history
+func pruneHistory(cacheDir, index string, keep int) error {
+	if keep <= 0 {
+		return os.RemoveAll(filepath.Join(cacheDir, index+historySuffix))
+	}
+
+	releases, err := ListReleases(cacheDir, index)
+	if err != nil {
+		return err
+	}
+	releases = slices.DeleteFunc(releases, func(r Release) bool {
+		return r.Current
+	})
+
+	for _, release := range releases[:max(len(releases)-keep, 0)] {
+		err := os.RemoveAll(filepath.Join(release.dir, release.name))
+		if err != nil {
+			return fmt.Errorf("remove %s: %w", release.Name(), err)
+		}
+	}
+
+	return nil
+}
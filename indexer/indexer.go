@@ -1,12 +1,18 @@
 package indexer
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -20,24 +26,80 @@ type Index struct {
 	Name     string
 	Fetcher  Fetcher
 	Metadata IndexMetadata
+	// Pin, if set, is the only release the index is built from
+	Pin Pin
+}
+
+// Pin is either an exact release or a git revision, which
+// is resolved to the release built from it
+type Pin struct {
+	Release  string `json:"release,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+func (p Pin) IsZero() bool {
+	return p == Pin{}
+}
+
+// RevisionResolver is implemented by the fetchers that can
+// download any release, not only the latest one. Only such
+// indexes can be pinned
+type RevisionResolver interface {
+	// ResolveRevision returns the release built from the git revision
+	ResolveRevision(ctx context.Context, revision string) (string, error)
 }
 
 type IndexMetadata struct {
 	LastIndexedAt time.Time `json:"last_indexed_at"`
 	CurrRelease   string    `json:"curr_release"`
+	// Storage is the kind of the storage the index is kept in. See `NewStorage`
+	Storage string `json:"storage,omitempty"`
+	// Packages is the number of packages in the current release
+	Packages int `json:"packages,omitempty"`
+	// BuildID changes every time the index directory is replaced, even if
+	// the release stays the same, like after `index --force`. Processes keeping
+	// the index open use it to notice that they hold an outdated snapshot
+	BuildID string `json:"build_id,omitempty"`
+
+	// The fields below describe the last indexing attempt, which
+	// might have failed. In that case, the rest of the metadata
+	// still describes the current release
+	LastAttemptAt time.Time     `json:"last_attempt_at,omitzero"`
+	LastDuration  time.Duration `json:"last_duration,omitempty"`
+	LastError     string        `json:"last_error,omitempty"`
+
+	// Pin is the pin the current release was resolved from
+	Pin Pin `json:"pin,omitzero"`
+}
+
+// Options configure the indexing
+type Options struct {
+	CacheDir string
+	// Storage is the kind of the storage new releases
+	// are indexed into. See `NewStorage`
+	Storage string
+	// KeepReleases is the number of previous releases kept
+	// in the history of every index. See `ListReleases`
+	KeepReleases int
+	// Force rebuilds the indexes even if there
+	// are no new releases
+	Force bool
 }
 
 type IndexingResult struct {
 	Index string
 	Err   error
+	// Transient tells if the error may go away on its own. See `IsTransient`
+	Transient bool
 }
 
 func RunIndexing(
 	ctx context.Context,
-	cacheDir string,
+	opts Options,
 	indexes []Index,
 ) <-chan IndexingResult {
 	results := make(chan IndexingResult)
+	tracker := newProgressTracker(opts.CacheDir, indexes)
 
 	wg := sync.WaitGroup{}
 	wg.Add(len(indexes))
@@ -47,19 +109,36 @@ func RunIndexing(
 			defer wg.Done()
 
 			var err error
+			started := time.Now()
+			progress := &indexProgress{tracker, index.Name}
 			defer func() {
 				if r := recover(); r != nil {
 					err = fmt.Errorf("index panicked: %v", r)
 				}
+				if err != nil {
+					recordFailure(opts.CacheDir, index, started, err)
+					progress.setPhase(PhaseFailed)
+				} else {
+					progress.setPhase(PhaseDone)
+				}
 
-				results <- IndexingResult{index.Name, err}
+				results <- IndexingResult{index.Name, err, IsTransient(err)}
 			}()
 
-			err = runIndex(ctx, cacheDir, index)
+			downloadDir := filepath.Join(opts.CacheDir, index.Name+downloadSuffix)
+			ctx := WithDownloadDir(withProgress(ctx, progress), downloadDir)
+			err = runIndex(ctx, opts, index)
+
+			// Only the transient failures, like a dropped connection,
+			// are worth resuming. Otherwise, the next attempt starts over
+			if err == nil || !IsTransient(err) {
+				os.RemoveAll(downloadDir)
+			}
 		}()
 	}
 	go func() {
 		wg.Wait()
+		tracker.close()
 		close(results)
 	}()
 
@@ -68,54 +147,194 @@ func RunIndexing(
 
 func runIndex(
 	ctx context.Context,
-	cacheDir string,
+	opts Options,
 	index Index,
 ) error {
-	indexDir := filepath.Join(cacheDir, index.Name)
-	latest, err := index.Fetcher.GetLatestRelease(ctx, index.Metadata)
+	started := time.Now()
+	indexDir := filepath.Join(opts.CacheDir, index.Name)
+	latest, err := getRelease(ctx, index)
 	if err != nil {
-		return fmt.Errorf("get latest release: %w", err)
+		return err
 	}
-	if latest == index.Metadata.CurrRelease {
-		_ = setIndexMetadata(indexDir, IndexMetadata{
-			LastIndexedAt: time.Now(),
-			CurrRelease:   latest,
-		})
+	// Changing the storage kind in the config rebuilds
+	// the index even if the release is the same
+	sameStorage := cmp.Or(index.Metadata.Storage, StorageBadger) == cmp.Or(opts.Storage, StorageBadger)
+	if latest == index.Metadata.CurrRelease && sameStorage && !opts.Force {
+		md := index.Metadata
+		md.LastIndexedAt = time.Now()
+		md.LastAttemptAt = started
+		md.LastDuration = time.Since(started)
+		md.LastError = ""
+		md.Pin = index.Pin
+		_ = setIndexMetadata(indexDir, md)
 		return nil
 	}
 
-	pkgs, err := index.Fetcher.DownloadRelease(ctx, latest)
+	// The new release is indexed into a staging directory, which replaces
+	// the current index only when everything succeeded. That way, a failed
+	// download or an interruption never destroys the last good index, and
+	// the previews keep working while the indexing is in progress
+	stagingDir := indexDir + stagingSuffix
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("remove previous staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	progressFrom(ctx).setPhase(PhaseDownloading)
+	packages, err := buildIndex(ctx, stagingDir, opts.Storage, index.Fetcher, latest)
+	if err != nil {
+		return err
+	}
+
+	err = setIndexMetadata(stagingDir, IndexMetadata{
+		LastIndexedAt: time.Now(),
+		CurrRelease:   latest,
+		Storage:       cmp.Or(opts.Storage, StorageBadger),
+		Packages:      packages,
+		BuildID:       newBuildID(),
+		LastAttemptAt: started,
+		LastDuration:  time.Since(started),
+		Pin:           index.Pin,
+	})
 	if err != nil {
-		return fmt.Errorf("download latest release: %w", err)
+		return fmt.Errorf("set metadata: %w", err)
+	}
+
+	archive := ""
+	if opts.KeepReleases > 0 && index.Metadata.CurrRelease != "" && index.Metadata.CurrRelease != latest {
+		archive = archiveDir(opts.CacheDir, index.Name, index.Metadata.CurrRelease)
+	}
+
+	err = swapDirs(stagingDir, indexDir, archive)
+	if err != nil {
+		return fmt.Errorf("replace index: %w", err)
+	}
+
+	// The new release is already in place, so an outdated
+	// history is not a reason to report the indexing as failed
+	_ = pruneHistory(opts.CacheDir, index.Name, opts.KeepReleases)
+
+	return nil
+}
+
+// getRelease returns the release the index should be built from,
+// which is either the pinned one or the latest one
+func getRelease(ctx context.Context, index Index) (string, error) {
+	if index.Pin.IsZero() {
+		latest, err := index.Fetcher.GetLatestRelease(ctx, index.Metadata)
+		if err != nil {
+			return "", fmt.Errorf("get latest release: %w", err)
+		}
+		return latest, nil
+	}
+
+	resolver, ok := index.Fetcher.(RevisionResolver)
+	if !ok {
+		return "", errors.New("the index does not support pinning")
+	}
+	if index.Pin.Release != "" {
+		return index.Pin.Release, nil
+	}
+
+	release, err := resolver.ResolveRevision(ctx, index.Pin.Revision)
+	if err != nil {
+		return "", fmt.Errorf("resolve revision %s: %w", index.Pin.Revision, err)
+	}
+
+	return release, nil
+}
+
+// ReleaseHasRevision reports whether the release is built from the git revision.
+// The nixpkgs releases end with a short revision, like `nixpkgs-25.05pre747523.95ea544c84eb`,
+// so both the full and the short revisions match
+func ReleaseHasRevision(release, revision string) bool {
+	short := release[strings.LastIndexByte(release, '.')+1:]
+	if len(short) < 7 || len(revision) < 7 {
+		return false
+	}
+
+	return strings.HasPrefix(revision, short) || strings.HasPrefix(short, revision)
+}
+
+// buildIndex downloads the release and indexes it into
+// the given directory. It returns the number of indexed packages
+func buildIndex(
+	ctx context.Context,
+	dir string,
+	storage string,
+	fetcher Fetcher,
+	release string,
+) (int, error) {
+	pkgs, err := fetcher.DownloadRelease(ctx, release)
+	if err != nil {
+		return 0, fmt.Errorf("download latest release: %w", err)
 	}
 	defer pkgs.Close()
 
-	cache, err := CacheWriter(indexDir)
+	cache, err := CacheWriter(dir)
 	if err != nil {
-		return fmt.Errorf("open cache write: %w", err)
+		return 0, fmt.Errorf("open cache write: %w", err)
 	}
 	defer cache.Close()
 
-	badgerDir := filepath.Join(indexDir, "badger")
-	indexer, err := NewBadger(BadgerConfig{
-		Dir: badgerDir,
-	})
+	indexer, err := NewStorage(storage, dir)
 	if err != nil {
-		return fmt.Errorf("open indexer: %w", err)
+		return 0, fmt.Errorf("open indexer: %w", err)
 	}
-	defer indexer.Close()
 
-	err = indexer.Index(pkgs, cache)
+	columns, err := ColumnsWriter(dir)
 	if err != nil {
-		return fmt.Errorf("index packages: %w", err)
+		return 0, fmt.Errorf("open columns writer: %w", err)
 	}
+	defer columns.Close()
 
-	_ = setIndexMetadata(indexDir, IndexMetadata{
-		LastIndexedAt: time.Now(),
-		CurrRelease:   latest,
-	})
+	// Every indexed key is written as a separate line
+	keys := &lineCounter{w: cache, progress: progressFrom(ctx)}
+	columnsBuf := bufio.NewWriter(columns)
+	err = indexer.Index(pkgs, keys, columnsBuf)
+	if err != nil {
+		indexer.Close()
+		return 0, fmt.Errorf("index packages: %w", err)
+	}
+	if err = columnsBuf.Flush(); err != nil {
+		indexer.Close()
+		return 0, fmt.Errorf("write columns: %w", err)
+	}
 
-	return nil
+	progressFrom(ctx).setPhase(PhaseSaving)
+
+	// Closing flushes the index to disk, so it must succeed
+	// before the index can replace the current one
+	if err = indexer.Close(); err != nil {
+		return 0, fmt.Errorf("close indexer: %w", err)
+	}
+
+	return keys.lines, nil
+}
+
+// recordFailure saves the failed attempt into the metadata
+// of the current release, so that it can be seen in the status
+func recordFailure(cacheDir string, index Index, started time.Time, err error) {
+	md := index.Metadata
+	md.LastAttemptAt = started
+	md.LastDuration = time.Since(started)
+	md.LastError = err.Error()
+
+	_ = setIndexMetadata(filepath.Join(cacheDir, index.Name), md)
+}
+
+type lineCounter struct {
+	w        io.Writer
+	lines    int
+	progress *indexProgress
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	lc.lines += bytes.Count(p, []byte{'\n'})
+	lc.progress.update(func(progress *Progress) {
+		progress.Packages = lc.lines
+	})
+	return lc.w.Write(p)
 }
 
 type OptionFileFetcher interface {
@@ -130,6 +349,16 @@ func NeedIndexing(
 	needIndex := []Index{}
 
 	for _, index := range indexes {
+		// A pinned index is built once and never updated, until the pin changes.
+		// Once the pin is removed, the index is updated to the latest release
+		if !index.Pin.IsZero() || !index.Metadata.Pin.IsZero() {
+			if index.Pin != index.Metadata.Pin {
+				needIndex = append(needIndex, index)
+			}
+
+			continue
+		}
+
 		if file, ok := index.Fetcher.(OptionFileFetcher); ok {
 			path := file.Path()
 			if path != index.Metadata.CurrRelease {
@@ -157,11 +386,27 @@ func OpenKeysReader(cacheDir, index string) (io.ReadCloser, error) {
 	return os.OpenFile(path, os.O_RDONLY, 0666)
 }
 
+func readKeys(cacheDir, index string) ([]string, error) {
+	keysFile, err := OpenKeysReader(cacheDir, index)
+	if err != nil {
+		return nil, fmt.Errorf("read keys file: %w", err)
+	}
+	defer keysFile.Close()
+
+	keys := []string{}
+	scanner := bufio.NewScanner(keysFile)
+	for scanner.Scan() {
+		keys = append(keys, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan keys file: %w", err)
+	}
+
+	return keys, nil
+}
+
 func LoadKey(cacheDir, index, key string) (json.RawMessage, error) {
-	badgerDir := filepath.Join(cacheDir, index, "badger")
-	indexer, err := NewBadger(BadgerConfig{
-		Dir: badgerDir,
-	})
+	indexer, err := OpenIndex(cacheDir, index)
 	if err != nil {
 		return nil, fmt.Errorf("open indexer: %w", err)
 	}
@@ -174,3 +419,90 @@ func LoadKey(cacheDir, index, key string) (json.RawMessage, error) {
 
 	return data, nil
 }
+
+func SearchKeys(cacheDir, index, query string) (SearchResult, error) {
+	keys, err := readKeys(cacheDir, index)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	indexer, err := OpenIndex(cacheDir, index)
+	if errors.Is(err, ErrNotIndexed) {
+		return SearchResult{}, nil
+	}
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("open indexer: %w", err)
+	}
+	defer indexer.Close()
+
+	return Search(indexer, query, keys)
+}
+
+// IndexSize returns the size of the current release on disk
+func IndexSize(cacheDir, index string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(filepath.Join(cacheDir, index), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+// IsIndexing reports whether a new release of the index is
+// being built at the moment
+func IsIndexing(cacheDir, index string) bool {
+	_, err := os.Stat(filepath.Join(cacheDir, index+stagingSuffix))
+	return err == nil
+}
+
+// TransientError is a failure that may go away on its own, like a network
+// timeout or an unavailable server, so the indexing may succeed next time
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether the error is transient. An interrupted
+// indexing is transient as well, because nothing is wrong with the index
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+type downloadDirKey struct{}
+
+// WithDownloadDir sets the directory the fetchers download the release into.
+// It is set by `RunIndexing`, and the fetchers can be tested with it
+func WithDownloadDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, downloadDirKey{}, dir)
+}
+
+// DownloadDir returns the directory the fetcher can download the release
+// into. The directory is kept if the indexing fails because of a transient
+// error, so a fetcher can resume the download on the next attempt
+func DownloadDir(ctx context.Context) (string, bool) {
+	dir, ok := ctx.Value(downloadDirKey{}).(string)
+	return dir, ok
+}
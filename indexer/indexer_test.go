@@ -0,0 +1,53 @@
+package indexer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReleaseHasRevision(t *testing.T) {
+	release := "nixpkgs/nixpkgs-25.05pre747523.95ea544c84eb"
+
+	assert.True(t, ReleaseHasRevision(release, "95ea544c84eb"))
+	assert.True(t, ReleaseHasRevision(release, "95ea544"))
+	assert.True(t, ReleaseHasRevision(release, "95ea544c84eb3f4d4f8b4d8b8e7d7c6b5a4f3e2d"))
+	assert.False(t, ReleaseHasRevision(release, "95ea5"))
+	assert.False(t, ReleaseHasRevision(release, "64e75cd44acf"))
+	assert.False(t, ReleaseHasRevision("no-revision", "95ea544c84eb"))
+}
+
+func TestSwapDirs(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "index"+stagingSuffix)
+	dst := filepath.Join(dir, "index")
+	archive := filepath.Join(dir, "history", "v1")
+
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(path, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(path, "release"), []byte(content), 0666))
+	}
+	read := func(path string) string {
+		data, err := os.ReadFile(filepath.Join(path, "release"))
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	// There is nothing to replace at first
+	write(src, "v1")
+	assert.NoError(t, swapDirs(src, dst, ""))
+	assert.Equal(t, "v1", read(dst))
+
+	write(src, "v2")
+	assert.NoError(t, swapDirs(src, dst, archive))
+	assert.Equal(t, "v2", read(dst))
+	assert.Equal(t, "v1", read(archive))
+
+	for _, path := range []string{src, dst + oldSuffix} {
+		_, err := os.Stat(path)
+		assert.IsError(t, err, fs.ErrNotExist)
+	}
+}
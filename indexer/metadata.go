@@ -1,6 +1,7 @@
 package indexer
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -45,7 +46,7 @@ func setIndexMetadata(dir string, md IndexMetadata) error {
 	if err != nil {
 		return fmt.Errorf("marshal metadata: %w", err)
 	}
-	err = os.WriteFile(mdpath, data, 0666)
+	err = writeFileAtomic(mdpath, data)
 	if err != nil {
 		return fmt.Errorf("write metadata: %w", err)
 	}
@@ -53,13 +54,117 @@ func setIndexMetadata(dir string, md IndexMetadata) error {
 	return nil
 }
 
+func newBuildID() string {
+	return rand.Text()
+}
+
+// writeFileAtomic writes the data into a temporary file first and then
+// renames it, so that concurrent readers never see a half-written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), 0666); err != nil {
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+const (
+	stagingSuffix = ".staging"
+	oldSuffix     = ".old"
+
+	// downloadSuffix is appended to the index name to get the directory the
+	// releases are downloaded into. Unlike the staging directory, it outlives
+	// a failed indexing, so that the next attempt resumes the download
+	downloadSuffix = ".download"
+)
+
+// swapDirs replaces the dst directory with src. If archive is not empty, the
+// previous dst is moved there. Otherwise, it is removed after src took its place.
+//
+// On linux, the directories are exchanged atomically. Elsewhere, or if the file
+// system does not support that, dst is moved away before src is moved in, and
+// in between the two renames dst is missing. The commands reading the index
+// at that moment fail as if it was not indexed yet
+func swapDirs(src, dst, archive string) error {
+	old := dst + oldSuffix
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("remove old directory: %w", err)
+	}
+
+	if err := exchangeDirs(src, dst); err == nil {
+		// src holds the previous dst now. The new index is already
+		// in place, so if it cannot be moved, only the previous one is
+		// lost. It must not be left at src, as that is the staging directory
+		if err = os.Rename(src, old); err != nil {
+			return os.RemoveAll(src)
+		}
+	} else if err := renameDirs(src, dst, old); err != nil {
+		return err
+	}
+
+	if archive != "" {
+		err := os.MkdirAll(filepath.Dir(archive), 0755)
+		if err == nil {
+			err = os.RemoveAll(archive)
+		}
+		if err == nil {
+			err = os.Rename(old, archive)
+		}
+		// The new index is already in place, so failing to keep
+		// the previous one is not worth failing the indexing
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+	}
+
+	return os.RemoveAll(old)
+}
+
+// renameDirs moves dst to old, and then src to dst
+func renameDirs(src, dst, old string) error {
+	err := os.Rename(dst, old)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("move current directory: %w", err)
+	}
+
+	err = os.Rename(src, dst)
+	if err != nil {
+		// A concurrent command, like preview, might have re-created
+		// the directory in between the two renames. It can't contain
+		// anything useful, so just remove it and try again
+		if rmErr := os.RemoveAll(dst); rmErr == nil {
+			err = os.Rename(src, dst)
+		}
+	}
+	if err != nil {
+		// Try to put the previous directory back
+		_ = os.Rename(old, dst)
+		return fmt.Errorf("move new directory: %w", err)
+	}
+
+	return nil
+}
+
 func CacheWriter(dir string) (io.WriteCloser, error) {
 	cpath, err := initFile(dir, cacheFile, nil)
 	if err != nil {
 		return nil, fmt.Errorf("init cache: %w", err)
 	}
 
-	return os.OpenFile(cpath, os.O_WRONLY, 0666)
+	return os.OpenFile(cpath, os.O_WRONLY|os.O_TRUNC, 0666)
 }
 
 func CacheReader(dir string) (io.ReadCloser, error) {
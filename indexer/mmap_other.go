@@ -0,0 +1,18 @@
+//go:build !unix
+
+package indexer
+
+import (
+	"os"
+)
+
+// mmapFile reads the whole file into memory on
+// the platforms without mmap
+func mmapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,286 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// progressPattern matches the files keeping the progress of the running
+// indexing, so that other processes, like previews, can show it while they
+// wait. Every indexing run writes its own file, named after the process and
+// the run, so that concurrent runs never overwrite each other's progress
+const progressPattern = "indexing-*.json"
+
+// progressRuns numbers the indexing runs of the process
+var progressRuns atomic.Int64
+
+// progressInterval limits how often the progress file is rewritten
+const progressInterval = 250 * time.Millisecond
+
+type Phase string
+
+const (
+	PhaseChecking    Phase = "checking"
+	PhaseDownloading Phase = "downloading"
+	PhaseSaving      Phase = "saving"
+	PhaseDone        Phase = "done"
+	PhaseFailed      Phase = "failed"
+)
+
+// Progress is the state of the indexing of a single index
+type Progress struct {
+	Index string `json:"index"`
+	Phase Phase  `json:"phase"`
+	// Downloaded is the number of bytes of the release downloaded so far,
+	// and Total is the size of the release, or zero if it is unknown
+	Downloaded int64 `json:"downloaded"`
+	Total      int64 `json:"total,omitempty"`
+	// Packages is the number of packages indexed so far
+	Packages int `json:"packages"`
+}
+
+// Percent returns how much of the release is downloaded,
+// or -1 if the size of the release is unknown
+func (p Progress) Percent() int {
+	if p.Total <= 0 {
+		return -1
+	}
+	return int(min(p.Downloaded*100/p.Total, 100))
+}
+
+// ReadProgress returns the progress of the running indexing of all
+// processes, sorted by the index name. It returns nothing if there is no
+// indexing. The files left by crashed processes are ignored
+func ReadProgress(cacheDir string) ([]Progress, error) {
+	paths, err := filepath.Glob(filepath.Join(cacheDir, progressPattern))
+	if err != nil {
+		return nil, fmt.Errorf("list progress: %w", err)
+	}
+
+	byIndex := map[string]Progress{}
+	for _, path := range paths {
+		pid, ok := progressPID(filepath.Base(path))
+		if !ok || !processAlive(pid) {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The run has finished since the files were listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read progress: %w", err)
+		}
+
+		progress := []Progress{}
+		if err := json.Unmarshal(data, &progress); err != nil {
+			return nil, fmt.Errorf("unmarshal progress: %w", err)
+		}
+
+		for _, p := range progress {
+			// If two runs index the same index, the unfinished one wins
+			if prev, ok := byIndex[p.Index]; ok && !prev.finished() {
+				continue
+			}
+			byIndex[p.Index] = p
+		}
+	}
+
+	progress := []Progress{}
+	for _, index := range slices.Sorted(maps.Keys(byIndex)) {
+		progress = append(progress, byIndex[index])
+	}
+	if len(progress) == 0 {
+		return nil, nil
+	}
+
+	return progress, nil
+}
+
+func (p Progress) finished() bool {
+	return p.Phase == PhaseDone || p.Phase == PhaseFailed
+}
+
+// progressPID returns the process that wrote the progress file
+func progressPID(name string) (int, bool) {
+	name = strings.TrimPrefix(name, "indexing-")
+	pid, _, _ := strings.Cut(name, "-")
+	n, err := strconv.Atoi(pid)
+	return n, err == nil
+}
+
+// processAlive reports whether the process is running. On windows,
+// finding the process is enough, as it fails for exited processes
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// progressTracker collects the progress of the indexes
+// being indexed and writes it into the progress file
+type progressTracker struct {
+	path string
+
+	mu       sync.Mutex
+	progress map[string]*Progress
+	written  time.Time
+}
+
+// newProgressTracker writes the initial progress of the indexes. Nothing
+// is written if there is nothing to index, and the tracker is nil
+func newProgressTracker(cacheDir string, indexes []Index) *progressTracker {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	name := fmt.Sprintf("indexing-%d-%d.json", os.Getpid(), progressRuns.Add(1))
+	t := &progressTracker{
+		path:     filepath.Join(cacheDir, name),
+		progress: map[string]*Progress{},
+	}
+	for _, index := range indexes {
+		t.progress[index.Name] = &Progress{
+			Index: index.Name,
+			Phase: PhaseChecking,
+		}
+	}
+	t.write()
+
+	return t
+}
+
+// update changes the progress of the index and writes it, if either the
+// phase or the size of the download changed, or the progress was not
+// written for a while
+func (t *progressTracker) update(index string, fn func(*Progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.progress[index]
+	prev := *p
+	fn(p)
+
+	if p.Phase != prev.Phase || p.Total != prev.Total || time.Since(t.written) >= progressInterval {
+		t.write()
+	}
+}
+
+// write must be called with the mutex held
+func (t *progressTracker) write() {
+	progress := []Progress{}
+	for _, index := range slices.Sorted(maps.Keys(t.progress)) {
+		progress = append(progress, *t.progress[index])
+	}
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+
+	// The progress is only informational, so
+	// failing to write it does not fail the indexing
+	_ = writeFileAtomic(t.path, data)
+	t.written = time.Now()
+}
+
+func (t *progressTracker) close() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	os.Remove(t.path)
+}
+
+type progressKey struct{}
+
+// indexProgress reports the progress of a single index
+type indexProgress struct {
+	tracker *progressTracker
+	index   string
+}
+
+func withProgress(ctx context.Context, progress *indexProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+func progressFrom(ctx context.Context) *indexProgress {
+	p, _ := ctx.Value(progressKey{}).(*indexProgress)
+	return p
+}
+
+func (p *indexProgress) update(fn func(*Progress)) {
+	if p != nil {
+		p.tracker.update(p.index, fn)
+	}
+}
+
+func (p *indexProgress) setPhase(phase Phase) {
+	p.update(func(progress *Progress) {
+		progress.Phase = phase
+	})
+}
+
+// TrackDownload counts the bytes read from the body of the downloaded
+// release, so that the progress of the download can be seen while the
+// release is being indexed. The size is the expected size of the body,
+// like the Content-Length header, or -1 if it is unknown
+func TrackDownload(ctx context.Context, body io.ReadCloser, size int64) io.ReadCloser {
+	return TrackResumedDownload(ctx, body, 0, size)
+}
+
+// TrackResumedDownload is like `TrackDownload`, but for a download
+// resumed after the first `offset` bytes. The size is the size of the
+// whole release, not only of the body
+func TrackResumedDownload(ctx context.Context, body io.ReadCloser, offset, size int64) io.ReadCloser {
+	progress := progressFrom(ctx)
+	if progress == nil {
+		return body
+	}
+
+	progress.update(func(p *Progress) {
+		p.Downloaded = offset
+		p.Total = max(size, 0)
+	})
+
+	return &downloadCounter{body, progress}
+}
+
+type downloadCounter struct {
+	io.ReadCloser
+	progress *indexProgress
+}
+
+func (dc *downloadCounter) Read(b []byte) (int, error) {
+	n, err := dc.ReadCloser.Read(b)
+	dc.progress.update(func(p *Progress) {
+		p.Downloaded += int64(n)
+	})
+	return n, err
+}
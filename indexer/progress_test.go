@@ -0,0 +1,146 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// pipeFetcher serves the release written into the pipe
+type pipeFetcher struct {
+	r    *io.PipeReader
+	size int64
+}
+
+func (f *pipeFetcher) GetLatestRelease(ctx context.Context, md IndexMetadata) (string, error) {
+	return "latest", nil
+}
+
+func (f *pipeFetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	return TrackDownload(ctx, f.r, f.size), nil
+}
+
+func TestProgress(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	release := `{"packages":{"fzf":{},"tv":{}}}`
+	r, w := io.Pipe()
+	fetcher := &pipeFetcher{r, int64(len(release))}
+
+	results := RunIndexing(context.TODO(), Options{CacheDir: cacheDir}, []Index{
+		{Name: "nixpkgs", Fetcher: fetcher},
+	})
+
+	_, err := io.WriteString(w, release[:10])
+	assert.NoError(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		progress, err := ReadProgress(cacheDir)
+		assert.NoError(t, err)
+		if len(progress) == 1 && progress[0].Phase == PhaseDownloading && progress[0].Total > 0 {
+			assert.Equal(t, "nixpkgs", progress[0].Index)
+			assert.Equal(t, int64(len(release)), progress[0].Total)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no download progress, got %v", progress)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = io.WriteString(w, release[10:])
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	for result := range results {
+		assert.NoError(t, result.Err)
+	}
+
+	// The progress is gone once the indexing is finished
+	files, err := filepath.Glob(filepath.Join(cacheDir, progressPattern))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	md, err := GetIndexMetadata(cacheDir, "nixpkgs")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, md.Packages)
+}
+
+func TestOverlappingProgress(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	// waitProgress waits until the progress has the indexes downloading
+	waitProgress := func(t *testing.T, indexes ...string) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			progress, err := ReadProgress(cacheDir)
+			assert.NoError(t, err)
+
+			downloading := []string{}
+			for _, p := range progress {
+				if p.Phase == PhaseDownloading {
+					downloading = append(downloading, p.Index)
+				}
+			}
+			if slices.Equal(indexes, downloading) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v downloading, got %v", indexes, progress)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	release := `{"packages":{"fzf":{}}}`
+	r1, w1 := io.Pipe()
+	first := RunIndexing(context.TODO(), Options{CacheDir: cacheDir}, []Index{
+		{Name: "nixpkgs", Fetcher: &pipeFetcher{r1, int64(len(release))}},
+	})
+	waitProgress(t, "nixpkgs")
+
+	// A run with nothing to index must not touch the progress of the other runs
+	for result := range RunIndexing(context.TODO(), Options{CacheDir: cacheDir}, nil) {
+		assert.NoError(t, result.Err)
+	}
+	waitProgress(t, "nixpkgs")
+
+	r2, w2 := io.Pipe()
+	second := RunIndexing(context.TODO(), Options{CacheDir: cacheDir}, []Index{
+		{Name: "nur", Fetcher: &pipeFetcher{r2, int64(len(release))}},
+	})
+	waitProgress(t, "nixpkgs", "nur")
+
+	_, err := io.WriteString(w2, release)
+	assert.NoError(t, err)
+	assert.NoError(t, w2.Close())
+	for result := range second {
+		assert.NoError(t, result.Err)
+	}
+	waitProgress(t, "nixpkgs")
+
+	_, err = io.WriteString(w1, release)
+	assert.NoError(t, err)
+	assert.NoError(t, w1.Close())
+	for result := range first {
+		assert.NoError(t, result.Err)
+	}
+
+	progress, err := ReadProgress(cacheDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(progress))
+}
+
+func TestProgressPercent(t *testing.T) {
+	assert.Equal(t, -1, Progress{Downloaded: 10}.Percent())
+	assert.Equal(t, 50, Progress{Downloaded: 10, Total: 20}.Percent())
+	assert.Equal(t, 100, Progress{Downloaded: 30, Total: 20}.Percent())
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// providesPrefix is prepended to the main programs stored in the
+// index. Like `searchPrefix`, it cannot clash with a package name
+const providesPrefix = "\x00provides/"
+
+// providesMarker is stored in every index with the main programs,
+// so that the indexes built before them can be told apart
+const providesMarker = "\x00provides"
+
+// ErrNoProvides is returned for indexes built before the
+// main programs were introduced. They have to be indexed again
+var ErrNoProvides = errors.New("the index has no main programs, rebuild it with `nix-search-tv index --force`")
+
+// mainProgram returns the `meta.mainProgram` of the package.
+// Options and malformed packages have none
+func mainProgram(content []byte) string {
+	pkg := struct {
+		Meta struct {
+			MainProgram string `json:"mainProgram"`
+		} `json:"meta"`
+	}{}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return ""
+	}
+
+	return pkg.Meta.MainProgram
+}
+
+// Provides returns the names of the packages whose main program
+// is the command, shorter names first
+func Provides(store Storage, command string) ([]string, error) {
+	if command == "" {
+		return nil, nil
+	}
+
+	names, err := store.Load(providesPrefix + command)
+	if errors.Is(err, ErrNotFound) {
+		_, err = store.Load(providesMarker)
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNoProvides
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load main programs marker: %w", err)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load main program: %w", err)
+	}
+
+	keys := strings.Split(string(names), "\n")
+	slices.SortFunc(keys, byLength)
+
+	return keys, nil
+}
+
+// ProvidesKeys looks up the packages providing the command in the current index
+func ProvidesKeys(cacheDir, index, command string) ([]string, error) {
+	storage, err := OpenIndex(cacheDir, index)
+	if errors.Is(err, ErrNotIndexed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open indexer: %w", err)
+	}
+	defer storage.Close()
+
+	return Provides(storage, command)
+}
@@ -0,0 +1,211 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Query is a list of terms, all of which a package must match.
+//
+// A term is either a word matched against the package name, or a
+// `field:value` pair. Any term can be negated with a leading "-", and
+// the boolean fields can be given without a value, so that `-broken`
+// is the same as `broken:false`
+type Query []queryTerm
+
+type queryTerm struct {
+	field  string
+	value  string
+	negate bool
+}
+
+// queryFields maps the fields to the functions checking them
+var queryFields = map[string]func(pkg *queryable, value string) bool{
+	"name": func(pkg *queryable, value string) bool {
+		return strings.Contains(strings.ToLower(pkg.name), strings.ToLower(value))
+	},
+	"license": func(pkg *queryable, value string) bool {
+		// The ids are matched exactly, so that `mit` does not match `MIT-0`
+		return slices.ContainsFunc(pkg.licenses(), func(l license) bool {
+			return strings.EqualFold(l.SpdxID, value) ||
+				strings.EqualFold(l.ShortName, value) ||
+				strings.EqualFold(l.FullName, value)
+		})
+	},
+	"platform": func(pkg *queryable, value string) bool {
+		return slices.Contains(pkg.Meta.Platforms, value)
+	},
+	"broken": func(pkg *queryable, value string) bool {
+		return strconv.FormatBool(pkg.Meta.Broken) == value
+	},
+	"unfree": func(pkg *queryable, value string) bool {
+		return strconv.FormatBool(pkg.unfree()) == value
+	},
+	"main": func(pkg *queryable, value string) bool {
+		return pkg.Meta.MainProgram == value
+	},
+	"type": func(pkg *queryable, value string) bool {
+		return strings.Contains(strings.ToLower(pkg.Type), strings.ToLower(value))
+	},
+}
+
+// boolFields can be given without a value
+var boolFields = []string{"broken", "unfree"}
+
+// QueryFields returns the names of the fields a query can filter by
+func QueryFields() []string {
+	fields := []string{}
+	for field := range queryFields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+func ParseQuery(text string) (Query, error) {
+	query := Query{}
+
+	for _, word := range strings.Fields(text) {
+		term := queryTerm{}
+
+		if rest, ok := strings.CutPrefix(word, "-"); ok && rest != "" {
+			term.negate = true
+			word = rest
+		}
+
+		field, value, ok := strings.Cut(word, ":")
+		switch {
+		case !ok && slices.Contains(boolFields, word):
+			term.field, term.value = word, "true"
+		case !ok:
+			term.field, term.value = "name", word
+		default:
+			term.field, term.value = strings.ToLower(field), value
+		}
+
+		if _, known := queryFields[term.field]; !known {
+			return nil, fmt.Errorf("unknown field %q, expected one of: %s", term.field, strings.Join(QueryFields(), ", "))
+		}
+		if term.value == "" {
+			return nil, fmt.Errorf("%q has no value", word)
+		}
+		if slices.Contains(boolFields, term.field) && term.value != "true" && term.value != "false" {
+			return nil, fmt.Errorf("%q expects true or false, got %q", term.field, term.value)
+		}
+
+		query = append(query, term)
+	}
+
+	if len(query) == 0 {
+		return nil, errors.New("the query is empty")
+	}
+
+	return query, nil
+}
+
+// Match reports whether the package matches all the terms of the query.
+// Malformed packages match nothing
+func (query Query) Match(name string, content []byte) bool {
+	pkg := queryable{name: name}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return false
+	}
+
+	for _, term := range query {
+		if queryFields[term.field](&pkg, term.value) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// queryable contains the fields a query can filter by. Like
+// `searchable`, it covers both packages (nixpkgs, nur) and options
+type queryable struct {
+	name string
+
+	Type string `json:"type"`
+	Meta struct {
+		License     json.RawMessage `json:"license"`
+		Platforms   []string        `json:"platforms"`
+		Broken      bool            `json:"broken"`
+		Unfree      bool            `json:"unfree"`
+		MainProgram string          `json:"mainProgram"`
+	} `json:"meta"`
+}
+
+type license struct {
+	SpdxID    string `json:"spdxId"`
+	ShortName string `json:"shortName"`
+	FullName  string `json:"fullName"`
+	Free      *bool  `json:"free"`
+}
+
+// licenses decodes the license, which is either a string, an
+// object, or a list of them. See `nixpkgs.ElemOrSlice`
+func (pkg *queryable) licenses() []license {
+	raw := []json.RawMessage{}
+	if err := json.Unmarshal(pkg.Meta.License, &raw); err != nil {
+		raw = []json.RawMessage{pkg.Meta.License}
+	}
+
+	licenses := []license{}
+	for _, data := range raw {
+		l := license{}
+		if err := json.Unmarshal(data, &l.FullName); err == nil {
+			licenses = append(licenses, l)
+			continue
+		}
+		if err := json.Unmarshal(data, &l); err == nil {
+			licenses = append(licenses, l)
+		}
+	}
+
+	return licenses
+}
+
+// unfree reports whether the package is unfree. NUR packages
+// often have no `unfree` field, so their licenses are checked too
+func (pkg *queryable) unfree() bool {
+	return pkg.Meta.Unfree || slices.ContainsFunc(pkg.licenses(), func(l license) bool {
+		return l.Free != nil && !*l.Free
+	})
+}
+
+// QueryKeys returns the keys of the index matching the query
+func QueryKeys(cacheDir, index string, query Query) ([]string, error) {
+	storage, err := OpenIndex(cacheDir, index)
+	if errors.Is(err, ErrNotIndexed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open indexer: %w", err)
+	}
+	defer storage.Close()
+
+	keys, err := readKeys(cacheDir, index)
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys are sorted, so that the compact storage reads
+	// its blocks mostly in order, as the releases list the packages sorted
+	slices.Sort(keys)
+
+	matched := []string{}
+	for _, key := range keys {
+		content, err := storage.Load(key)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", key, err)
+		}
+		if query.Match(key, content) {
+			matched = append(matched, key)
+		}
+	}
+
+	return matched, nil
+}
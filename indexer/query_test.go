@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestQuery(t *testing.T) {
+	pkgs := map[string]string{
+		"ripgrep":             `{"meta": {"license": [{"spdxId": "MIT", "free": true}, {"spdxId": "Unlicense", "free": true}], "platforms": ["x86_64-linux", "aarch64-darwin"], "mainProgram": "rg"}}`,
+		"broken-tool":         `{"meta": {"license": {"spdxId": "GPL-3.0-or-later", "fullName": "GNU General Public License v3.0 or later"}, "platforms": ["x86_64-linux"], "broken": true}}`,
+		"nur-unfree":          `{"meta": {"license": {"free": false, "fullName": "Unfree"}}}`,
+		"string-license":      `{"meta": {"license": "MIT"}}`,
+		"mit-zero":            `{"meta": {"license": [{"spdxId": "MIT-0", "shortName": "mit0"}, {"spdxId": "MITNFA", "shortName": "mitnfa"}]}}`,
+		"programs.git.enable": `{"type": "boolean", "description": "Whether to enable Git."}`,
+	}
+
+	cases := []struct {
+		Query    string
+		Expected []string
+	}{
+		{"license:mit", []string{"ripgrep", "string-license"}},
+		{"license:mit0", []string{"mit-zero"}},
+		{"license:gpl", []string{}},
+		{"license:GPL-3.0-or-later", []string{"broken-tool"}},
+		{"license:unfree", []string{"nur-unfree"}},
+		{"platform:aarch64-darwin", []string{"ripgrep"}},
+		{"platform:x86_64-linux -broken", []string{"ripgrep"}},
+		{"broken", []string{"broken-tool"}},
+		{"broken:false main:rg", []string{"ripgrep"}},
+		{"unfree:true", []string{"nur-unfree"}},
+		{"type:bool", []string{"programs.git.enable"}},
+		{"git -type:string", []string{"programs.git.enable"}},
+		{"-name:tool license:gpl-3.0-or-later", []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Query, func(t *testing.T) {
+			query, err := ParseQuery(c.Query)
+			assert.NoError(t, err)
+
+			matched := []string{}
+			for _, name := range []string{"broken-tool", "mit-zero", "nur-unfree", "programs.git.enable", "ripgrep", "string-license"} {
+				if query.Match(name, []byte(pkgs[name])) {
+					matched = append(matched, name)
+				}
+			}
+			assert.Equal(t, c.Expected, matched)
+		})
+	}
+
+	t.Run("invalid queries", func(t *testing.T) {
+		_, err := ParseQuery("maintainer:me")
+		assert.EqualError(t, err, `unknown field "maintainer", expected one of: broken, license, main, name, platform, type, unfree`)
+
+		_, err = ParseQuery("broken:maybe")
+		assert.EqualError(t, err, `"broken" expects true or false, got "maybe"`)
+
+		_, err = ParseQuery("license:")
+		assert.EqualError(t, err, `"license:" has no value`)
+
+		_, err = ParseQuery("  ")
+		assert.EqualError(t, err, "the query is empty")
+	})
+}
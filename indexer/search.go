@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// searchPrefix is prepended to the description tokens stored
+// in the index. It starts with a zero byte, so it can never clash
+// with a real package name
+const searchPrefix = "\x00search/"
+
+// searchable contains the fields of a package that
+// are tokenized for the full-text search. Packages (nixpkgs, nur) keep
+// descriptions in `meta`, while options keep it at the top level
+type searchable struct {
+	Description string `json:"description"`
+	Meta        struct {
+		Description     string `json:"description"`
+		LongDescription string `json:"longDescription"`
+	} `json:"meta"`
+}
+
+var reHTMLTag = regexp.MustCompile(`<[^>]*>`)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "with": true, "you": true, "your": true,
+}
+
+// Tokenize splits the text into lowercase words, dropping
+// the stop words and duplicates
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := []string{}
+	seen := map[string]bool{}
+	for _, word := range words {
+		if len(word) < 2 || stopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+
+	return tokens
+}
+
+// descriptionTokens returns the tokens of the package description.
+// Malformed packages are not an error, they are just not searchable
+func descriptionTokens(content []byte) []string {
+	pkg := searchable{}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return nil
+	}
+
+	text := strings.Join([]string{
+		reHTMLTag.ReplaceAllString(pkg.Description, " "),
+		pkg.Meta.Description,
+		pkg.Meta.LongDescription,
+	}, " ")
+
+	return Tokenize(text)
+}
+
+// SearchResult contains the keys matching a search query
+type SearchResult struct {
+	// Keys containing all the query words in their names
+	Names []string
+	// Keys containing all the query words in their descriptions,
+	// but not in their names
+	Descriptions []string
+}
+
+// Search looks for the query words in the package names and descriptions.
+//
+// The keys are the names of all the indexed packages, as written to the keys file
+func Search(store Storage, query string, keys []string) (SearchResult, error) {
+	res := SearchResult{}
+
+	// The stop words are dropped from the name matches too,
+	// as they are never indexed for the description matches
+	words := slices.DeleteFunc(strings.Fields(strings.ToLower(query)), func(word string) bool {
+		return stopWords[word]
+	})
+	if len(words) == 0 {
+		return res, nil
+	}
+
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		matches := !slices.ContainsFunc(words, func(word string) bool {
+			return !strings.Contains(lower, word)
+		})
+		if matches {
+			res.Names = append(res.Names, key)
+		}
+	}
+
+	var found map[string]bool
+	for _, token := range Tokenize(query) {
+		posting, err := loadPosting(store, token)
+		if err != nil {
+			return res, err
+		}
+
+		next := map[string]bool{}
+		for _, key := range posting {
+			if found == nil || found[key] {
+				next[key] = true
+			}
+		}
+		found = next
+	}
+
+	for key := range found {
+		if !slices.Contains(res.Names, key) {
+			res.Descriptions = append(res.Descriptions, key)
+		}
+	}
+
+	slices.SortFunc(res.Names, byLength)
+	slices.SortFunc(res.Descriptions, byLength)
+
+	return res, nil
+}
+
+// byLength puts shorter names first, so that top-level packages
+// rank higher than the nested ones, like `python3Packages.*`
+func byLength(a, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+}
+
+// loadPosting returns the names of packages having the
+// token in their descriptions
+func loadPosting(store Storage, token string) ([]string, error) {
+	posting, err := store.Load(searchPrefix + token)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load search token: %w", err)
+	}
+
+	return strings.Split(string(posting), "\n"), nil
+}
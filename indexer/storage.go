@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer/jsonstream"
+)
+
+// Storage keeps the indexed packages.
+//
+// Every index is a write-once snapshot. A storage is either created
+// empty and filled by `Index`, or opened read-only to `Load` the packages
+type Storage interface {
+	// Index writes the packages into the storage, their names
+	// into the indexedKeys and their columns into the columns.
+	// See `columnsLine`
+	Index(data io.Reader, indexedKeys io.Writer, columns io.Writer) error
+	Load(key string) (json.RawMessage, error)
+	Close() error
+}
+
+const (
+	StorageBadger  = "badger"
+	StorageCompact = "compact"
+)
+
+var (
+	_ Storage = (*Badger)(nil)
+	_ Storage = (*Compact)(nil)
+)
+
+// NewStorage creates an empty storage of the given kind
+// in the index directory
+func NewStorage(kind, indexDir string) (Storage, error) {
+	switch kind {
+	case StorageBadger, "":
+		return NewBadger(BadgerConfig{
+			Dir: filepath.Join(indexDir, StorageBadger),
+		})
+	case StorageCompact:
+		return NewCompact(CompactConfig{
+			Dir: filepath.Join(indexDir, StorageCompact),
+		})
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", kind)
+}
+
+// OpenIndex opens the current index for reading
+func OpenIndex(cacheDir, index string) (Storage, error) {
+	md, err := GetIndexMetadata(cacheDir, index)
+	if err != nil {
+		return nil, fmt.Errorf("get metadata: %w", err)
+	}
+
+	indexDir := filepath.Join(cacheDir, index)
+
+	switch md.Storage {
+	// Indexes built before the storage became configurable
+	// do not have it in the metadata, and they are all badger
+	case StorageBadger, "":
+		return NewBadger(BadgerConfig{
+			Dir:      filepath.Join(indexDir, StorageBadger),
+			ReadOnly: true,
+		})
+	case StorageCompact:
+		return NewCompact(CompactConfig{
+			Dir:      filepath.Join(indexDir, StorageCompact),
+			ReadOnly: true,
+		})
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", md.Storage)
+}
+
+// indexPackages parses the packages and passes them to set. After the packages,
+// it passes the entries of the secondary indexes, like the search postings
+// and the main programs.
+//
+// Only the package names are written to the indexedKeys, and
+// their columns to the columns
+func indexPackages(data io.Reader, indexedKeys io.Writer, columns io.Writer, set func(key, value []byte) error) error {
+	// postings maps description tokens to the packages
+	// containing them. It is written after all the packages are
+	// processed, because a token's packages are spread all over the input
+	postings := map[string][]string{}
+	// programs maps the main programs to the packages providing them
+	programs := map[string][]string{}
+
+	err := jsonstream.ParsePackages(data, func(name string, content []byte) error {
+		nameb := []byte(name)
+
+		err := set(nameb, content)
+		if err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+
+		indexedKeys.Write(append(nameb, []byte("\n")...))
+		io.WriteString(columns, columnsLine(name, content)+"\n")
+
+		for _, token := range descriptionTokens(content) {
+			postings[token] = append(postings[token], name)
+		}
+		if program := mainProgram(content); program != "" {
+			programs[program] = append(programs[program], name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("handle packages: %w", err)
+	}
+
+	for token, names := range postings {
+		err = set([]byte(searchPrefix+token), []byte(strings.Join(names, "\n")))
+		if err != nil {
+			return fmt.Errorf("set search token %s: %w", token, err)
+		}
+	}
+	for program, names := range programs {
+		err = set([]byte(providesPrefix+program), []byte(strings.Join(names, "\n")))
+		if err != nil {
+			return fmt.Errorf("set main program %s: %w", program, err)
+		}
+	}
+	if err = set([]byte(providesMarker), nil); err != nil {
+		return fmt.Errorf("set main programs marker: %w", err)
+	}
+
+	return nil
+}
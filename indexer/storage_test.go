@@ -0,0 +1,150 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestStorages(t *testing.T) {
+	pkgs := `{"packages": {
+		"vim": {"version": "9.1", "meta": {"description": "The editor", "mainProgram": "vim"}},
+		"neovim": {"meta": {"description": "Vim-fork focused on extensibility", "mainProgram": "nvim"}},
+		"helix": {"meta": {"description": "A post-modern modal text editor"}},
+		"empty": {},
+		"programs.vim.enable": {"description": "<p>Whether to enable\n\tVim.</p>\n\n<p>Details</p>"}
+	}}`
+
+	for _, kind := range []string{StorageBadger, StorageCompact} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+
+			storage, err := NewStorage(kind, dir)
+			assert.NoError(t, err)
+
+			keys := bytes.Buffer{}
+			columns := bytes.Buffer{}
+			err = storage.Index(strings.NewReader(pkgs), &keys, &columns)
+			assert.NoError(t, err)
+			assert.NoError(t, storage.Close())
+
+			indexed := strings.Fields(keys.String())
+			lines := strings.Split(strings.TrimSpace(columns.String()), "\n")
+			if kind == StorageCompact {
+				// The compact storage writes the keys sorted
+				assert.True(t, slices.IsSorted(indexed))
+				assert.True(t, slices.IsSorted(lines))
+			}
+			slices.Sort(indexed)
+			assert.Equal(t, []string{"empty", "helix", "neovim", "programs.vim.enable", "vim"}, indexed)
+
+			slices.Sort(lines)
+			assert.Equal(t, []string{
+				"empty\t\t",
+				"helix\t\tA post-modern modal text editor",
+				"neovim\t\tVim-fork focused on extensibility",
+				"programs.vim.enable\t\tWhether to enable Vim.",
+				"vim\t9.1\tThe editor",
+			}, lines)
+
+			err = setIndexMetadata(dir, IndexMetadata{Storage: kind})
+			assert.NoError(t, err)
+
+			_, err = OpenIndex(t.TempDir(), "missing")
+			assert.IsError(t, err, ErrNotIndexed)
+
+			cacheDir, index := filepath.Split(dir)
+			storage, err = OpenIndex(cacheDir, index)
+			assert.NoError(t, err)
+			defer storage.Close()
+
+			pkg, err := storage.Load("helix")
+			assert.NoError(t, err)
+			assert.Equal(t, `{"meta": {"description": "A post-modern modal text editor"}}`, string(pkg))
+
+			_, err = storage.Load("emacs")
+			assert.IsError(t, err, ErrNotFound)
+
+			res, err := Search(storage, "editor", indexed)
+			assert.NoError(t, err)
+			assert.Equal(t, SearchResult{Descriptions: []string{"vim", "helix"}}, res)
+
+			// "the" is a stop word, so it matches neither names nor descriptions
+			res, err = Search(storage, "the vim", indexed)
+			assert.NoError(t, err)
+			assert.Equal(t, SearchResult{Names: []string{"vim", "neovim", "programs.vim.enable"}}, res)
+
+			provides, err := Provides(storage, "nvim")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"neovim"}, provides)
+
+			provides, err = Provides(storage, "hx")
+			assert.NoError(t, err)
+			assert.Equal(t, nil, provides)
+
+			// Indexes built before the main programs have no marker
+			_, err = Provides(withoutKey{storage, providesMarker}, "hx")
+			assert.IsError(t, err, ErrNoProvides)
+		})
+	}
+}
+
+func TestCompactBlocks(t *testing.T) {
+	storage, err := NewCompact(CompactConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	defer storage.Close()
+
+	// Enough packages to fill more than one block
+	pkgs := map[string]json.RawMessage{}
+	for i := range 10_000 {
+		pkgs[fmt.Sprintf("pkg-%05d", i)] = json.RawMessage(fmt.Sprintf(`{"n": %d}`, i))
+	}
+	data, err := json.Marshal(Indexable{Packages: pkgs})
+	assert.NoError(t, err)
+
+	keys := bytes.Buffer{}
+	err = storage.Index(bytes.NewReader(data), &keys, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, 10_000, strings.Count(keys.String(), "\n"))
+
+	// The columns are kept in a file only while indexing
+	_, err = os.Stat(filepath.Join(storage.dir, compactColumnsFile))
+	assert.IsError(t, err, fs.ErrNotExist)
+
+	for _, i := range []int{0, 1, 4242, 9999} {
+		pkg, err := storage.Load(fmt.Sprintf("pkg-%05d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"n":%d}`, i), string(pkg))
+	}
+}
+
+func TestCompactInvalidIndex(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, compactIndexFile), []byte("not an index"), 0666))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, compactValuesFile), []byte("values"), 0666))
+
+	_, err := NewCompact(CompactConfig{Dir: dir, ReadOnly: true})
+	assert.EqualError(t, err, "invalid index file")
+}
+
+// withoutKey hides the key of the storage, like if it was never indexed
+type withoutKey struct {
+	Storage
+	key string
+}
+
+func (s withoutKey) Load(key string) (json.RawMessage, error) {
+	if key == s.key {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return s.Storage.Load(key)
+}
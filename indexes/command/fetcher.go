@@ -0,0 +1,123 @@
+// Package command indexes the packages produced by an external program.
+//
+// The program is called with `latest-release <current release>` and must
+// print the id of the latest release. Then, if the release changed, it is
+// called with `download <release>` and must write the packages to stdout
+// in the indexer format, i.e. `{"packages": {"<name>": {...}}}`
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+)
+
+type Fetcher struct {
+	command []string
+}
+
+// NewFetcher returns a fetcher running the program with the given
+// arguments. The protocol arguments are appended to them
+func NewFetcher(command []string) *Fetcher {
+	return &Fetcher{
+		command: command,
+	}
+}
+
+func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	stderr := &bytes.Buffer{}
+	cmd := f.cmd(ctx, "latest-release", md.CurrRelease)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", commandError(err, stderr)
+	}
+
+	release := strings.TrimSpace(string(out))
+	if release == "" {
+		return "", errors.New("command printed an empty release")
+	}
+	return release, nil
+}
+
+func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	stderr := &bytes.Buffer{}
+	cmd := f.cmd(ctx, "download", release)
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("open stdout: %w", err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start command: %w", err)
+	}
+
+	body := &commandReader{stdout: stdout, cmd: cmd, stderr: stderr}
+	return indexer.TrackDownload(ctx, body, -1), nil
+}
+
+func (f *Fetcher) cmd(ctx context.Context, args ...string) *exec.Cmd {
+	args = append(f.command[1:len(f.command):len(f.command)], args...)
+	return exec.CommandContext(ctx, f.command[0], args...)
+}
+
+// commandReader reads the output of a running command. Once the output
+// is over, it waits for the command, so that if the command fails, the
+// error is returned instead of EOF and the half-written release is not indexed
+type commandReader struct {
+	stdout io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	done   bool
+	// err is returned by all the reads after the end of the output,
+	// as the command can be waited for only once
+	err error
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.stdout.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	r.done = true
+	r.err = io.EOF
+	if err := r.cmd.Wait(); err != nil {
+		r.err = commandError(err, r.stderr)
+	}
+	return n, r.err
+}
+
+// Close stops the command if its output has not been read till the end
+func (r *commandReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// commandError adds the stderr of the failed command to the error,
+// as it usually explains the failure better than the exit code
+func commandError(err error, stderr *bytes.Buffer) error {
+	msg := strings.TrimSpace(stderr.String())
+	if msg == "" {
+		return fmt.Errorf("run command: %w", err)
+	}
+	return fmt.Errorf("run command: %w: %s", err, msg)
+}
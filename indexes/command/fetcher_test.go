@@ -0,0 +1,58 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFetcher(t *testing.T) {
+	ctx := context.Background()
+	fetcher := NewFetcher([]string{"sh", "./testdata/plugin.sh"})
+
+	t.Run("latest release", func(t *testing.T) {
+		release, err := fetcher.GetLatestRelease(ctx, indexer.IndexMetadata{CurrRelease: "v1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", release)
+	})
+
+	t.Run("download", func(t *testing.T) {
+		body, err := fetcher.DownloadRelease(ctx, "v2")
+		assert.NoError(t, err)
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+
+		pkgs := indexer.Indexable{}
+		err = json.Unmarshal(data, &pkgs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(pkgs.Packages))
+
+		// The end of the output is remembered
+		_, err = body.Read(make([]byte, 1))
+		assert.IsError(t, err, io.EOF)
+	})
+
+	t.Run("failed download", func(t *testing.T) {
+		body, err := fetcher.DownloadRelease(ctx, "v3")
+		assert.NoError(t, err)
+		defer body.Close()
+
+		_, err = io.ReadAll(body)
+		assert.EqualError(t, err, "run command: exit status 1: unknown release v3")
+
+		_, err = body.Read(make([]byte, 1))
+		assert.EqualError(t, err, "run command: exit status 1: unknown release v3")
+	})
+
+	t.Run("empty release", func(t *testing.T) {
+		fetcher := NewFetcher([]string{"true"})
+		_, err := fetcher.GetLatestRelease(ctx, indexer.IndexMetadata{})
+		assert.EqualError(t, err, "command printed an empty release")
+	})
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+)
+
+// Package is what the external program is expected to write
+// for every package. All of the fields are optional
+type Package struct {
+	indexer.Package
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	Homepage    string `json:"homepage"`
+	Source      string `json:"source"`
+}
+
+func (pkg *Package) GetSource() string {
+	return pkg.Source
+}
+
+func (pkg *Package) GetHomepage() string {
+	return pkg.Homepage
+}
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	info := pkginfo.Info{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Description: pkg.Description,
+	}
+	if pkg.Homepage != "" {
+		info.Homepages = []string{pkg.Homepage}
+	}
+	if pkg.Source != "" {
+		info.Declarations = []string{pkg.Source}
+	}
+
+	return info
+}
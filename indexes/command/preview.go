@@ -0,0 +1,24 @@
+package command
+
+import (
+	"io"
+
+	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
+)
+
+// PreviewTemplate is the default preview of the packages
+const PreviewTemplate = `{{ name .Name }}{{ with .Version }} {{ dim (printf "(%s)" .) }}{{ end }}
+{{ with .Description }}{{ wrap . }}
+
+{{ end -}}
+{{ with .Homepage }}{{ prop "homepage" "" . }}
+{{ end -}}
+{{ with .Source }}{{ prop "source" "" . }}
+{{ end -}}
+`
+
+var previewTemplate = textutil.MustParseTemplate("command", PreviewTemplate)
+
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
+}
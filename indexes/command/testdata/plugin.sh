@@ -0,0 +1,21 @@
+#!/bin/sh
+# A plugin serving a single release "v2" with two modules
+case "$1" in
+latest-release)
+	echo "v2"
+	;;
+download)
+	if [ "$2" != "v2" ]; then
+		echo "unknown release $2" >&2
+		exit 1
+	fi
+	echo '{"packages": {'
+	echo '  "vpc": {"description": "Network for the services", "version": "2.1.0"},'
+	echo '  "bucket": {"description": "Storage bucket", "homepage": "https://example.com/bucket"}'
+	echo '}}'
+	;;
+*)
+	echo "unknown command $1" >&2
+	exit 2
+	;;
+esac
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+	"github.com/3timeslazy/nix-search-tv/pkgs/renderdocs"
 )
 
 type Package struct {
@@ -35,3 +37,14 @@ func (pkg *Package) GetSource() string {
 func (pkg *Package) GetHomepage() string {
 	return pkg.GetSource()
 }
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	return pkginfo.Info{
+		Name:         pkg.Name,
+		Description:  renderdocs.RenderHTML(strings.TrimSpace(pkg.Description)),
+		Type:         pkg.Type,
+		Default:      pkg.Default,
+		Example:      pkg.Example,
+		Declarations: pkg.DeclaredBy,
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"time"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
 	"github.com/3timeslazy/nix-search-tv/indexes/readutil"
 	"github.com/3timeslazy/nix-search-tv/pkgs/renderdocs"
 
@@ -17,15 +17,17 @@ import (
 	"golang.org/x/net/html"
 )
 
-type Fetcher struct{}
+type Fetcher struct {
+	page httputil.Page
+}
 
 const htmlURL = "https://nix-community.github.io/home-manager/options.xhtml"
 
-func (Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
-	return time.Now().String(), nil
+func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return f.page.Release(ctx, htmlURL, md.CurrRelease)
 }
 
-func (Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadCloser, error) {
+func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
 	var doc *html.Node
 	var err error
 
@@ -33,7 +35,7 @@ func (Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadCloser
 	if ok {
 		doc, err = htmlquery.LoadDoc(path)
 	} else {
-		doc, err = htmlquery.LoadURL(htmlURL)
+		doc, err = f.loadPage(ctx, release)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("download options.xhtml: %w", err)
@@ -80,3 +82,13 @@ func (Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadCloser
 
 	return readutil.PackagesWrapper(io.NopCloser(buf)), nil
 }
+
+func (f *Fetcher) loadPage(ctx context.Context, release string) (*html.Node, error) {
+	page, err := f.page.Open(ctx, htmlURL, release)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+
+	return htmlquery.Parse(page)
+}
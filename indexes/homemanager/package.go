@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+	"github.com/3timeslazy/nix-search-tv/pkgs/renderdocs"
 )
 
 type Package struct {
@@ -48,3 +50,19 @@ func (pkg *Package) GetSource() string {
 func (pkg *Package) GetHomepage() string {
 	return pkg.GetSource()
 }
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	declarations := []string{}
+	for _, decl := range pkg.Declarations {
+		declarations = append(declarations, decl.URL)
+	}
+
+	return pkginfo.Info{
+		Name:         pkg.Name,
+		Description:  renderdocs.RenderHTML(pkg.Description),
+		Type:         pkg.Type,
+		Default:      pkg.Default.Text,
+		Example:      pkg.Example.Text,
+		Declarations: declarations,
+	}
+}
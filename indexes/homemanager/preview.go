@@ -1,39 +1,24 @@
 package homemanager
 
 import (
-	"fmt"
 	"io"
 
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
 )
 
-func (pkg *Package) Preview(out io.Writer) {
-	pkgTitle := textutil.PkgName(pkg.Name) + "\n"
-	fmt.Fprint(out, pkgTitle)
-
-	desc := style.StyleHTML(pkg.Description)
-	desc += "\n"
-	fmt.Fprintln(out, desc)
+// PreviewTemplate is the default preview of the options
+const PreviewTemplate = `{{ name .Name }}
+{{ html .Description }}
 
-	typ := textutil.Prop("type", "", pkg.Type)
-	fmt.Fprintln(out, typ)
+{{ prop "type" "" .Type }}
+{{ with .Default.Text }}{{ prop "default" "" (code .) }}
+{{ end -}}
+{{ with .Example.Text }}{{ prop "example" "" (code .) }}
+{{ end -}}
+`
 
-	def := pkg.Default.Text
-	if def != "" {
-		def = textutil.Prop(
-			"default", "",
-			style.PrintCodeBlock(pkg.Default.Text),
-		)
-		fmt.Fprintln(out, def)
-	}
+var previewTemplate = textutil.MustParseTemplate("home-manager", PreviewTemplate)
 
-	example := ""
-	if pkg.Example.Text != "" {
-		example = textutil.Prop(
-			"example", "",
-			style.PrintCodeBlock(pkg.Example.Text),
-		)
-		fmt.Fprintln(out, example)
-	}
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
@@ -0,0 +1,244 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+)
+
+// Options configure the requests of all fetchers
+type Options struct {
+	// Timeout is how long to wait for the response, or for the next
+	// part of the body while downloading. Zero means no timeout
+	Timeout time.Duration
+	// Retries is how many times a request is retried after a transient failure
+	Retries int
+	// Backoff is the delay before the first retry, which
+	// doubles with every next one up to `maxBackoff`
+	Backoff time.Duration
+}
+
+var DefaultOptions = Options{
+	Timeout: 30 * time.Second,
+	Retries: 3,
+	Backoff: time.Second,
+}
+
+const maxBackoff = 30 * time.Second
+
+var (
+	optsMu sync.RWMutex
+	opts   = DefaultOptions
+)
+
+// SetOptions replaces the options of all following requests
+func SetOptions(o Options) {
+	optsMu.Lock()
+	defer optsMu.Unlock()
+
+	opts = o
+}
+
+func getOptions() Options {
+	optsMu.RLock()
+	defer optsMu.RUnlock()
+
+	return opts
+}
+
+// Get sends a GET request. See `Do`
+func Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	return Do(req)
+}
+
+// Do sends the request, retrying it with exponential backoff on timeouts,
+// dropped or refused connections and http 408, 429 and 5xx. The request
+// must have no body.
+//
+// Responses with http 4xx and 5xx are returned as errors. The errors that
+// may go away on their own are `indexer.TransientError`, the rest are permanent.
+//
+// The timeout applies to the response and to every read of its body,
+// so a download never hangs, but may take as long as it needs
+func Do(req *http.Request) (*http.Response, error) {
+	o := getOptions()
+	backoff := o.Backoff
+
+	for attempt := 0; ; attempt++ {
+		resp, err := do(req, o.Timeout)
+		if err == nil {
+			return resp, nil
+		}
+
+		var transient *indexer.TransientError
+		if !errors.As(err, &transient) || attempt >= o.Retries || req.Context().Err() != nil {
+			return nil, err
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+var errStalled = errors.New("no data received")
+
+func do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	watchdog := newWatchdog(timeout, cancel)
+
+	resp, err := http.DefaultClient.Do(req.Clone(ctx))
+	if err != nil {
+		watchdog.stop()
+		cancel(nil)
+
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		if errors.Is(context.Cause(ctx), errStalled) {
+			return nil, &indexer.TransientError{Err: fmt.Errorf("no response in %s", timeout)}
+		}
+		if isTransientError(err) {
+			return nil, &indexer.TransientError{Err: err}
+		}
+		// Bad urls, unknown hosts and invalid certificates
+		// do not go away by themselves, so they are not retried
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		watchdog.stop()
+		resp.Body.Close()
+		cancel(nil)
+
+		err := &StatusError{Code: resp.StatusCode, Header: resp.Header}
+		if isTransientStatus(resp.StatusCode) {
+			return nil, &indexer.TransientError{Err: err}
+		}
+		return nil, err
+	}
+
+	watchdog.reset()
+	resp.Body = &watchedBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		cancel:     cancel,
+		watchdog:   watchdog,
+		timeout:    timeout,
+	}
+	return resp, nil
+}
+
+// StatusError is an unexpected http status of the response
+type StatusError struct {
+	Code   int
+	Header http.Header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("expected http 200, but %d", e.Code)
+}
+
+// isTransientError reports whether the request failed because of
+// the network or the server being unavailable for a while
+func isTransientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		// The server closed the connection before responding
+		errors.Is(err, io.EOF)
+}
+
+func isTransientStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests ||
+		code >= 500
+}
+
+// watchdog cancels the request if it is not reset in time
+type watchdog struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newWatchdog(timeout time.Duration, cancel context.CancelCauseFunc) *watchdog {
+	if timeout <= 0 {
+		return &watchdog{}
+	}
+
+	return &watchdog{
+		timer:   time.AfterFunc(timeout, func() { cancel(errStalled) }),
+		timeout: timeout,
+	}
+}
+
+func (w *watchdog) reset() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	watchdog *watchdog
+	timeout  time.Duration
+}
+
+// Read reports the failures of the connection, like
+// a dropped one, as transient
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(context.Cause(b.ctx), errStalled) {
+		return n, &indexer.TransientError{Err: fmt.Errorf("download stalled: no data in %s", b.timeout)}
+	}
+	if err != nil && err != io.EOF && b.ctx.Err() == nil {
+		return n, &indexer.TransientError{Err: err}
+	}
+	b.watchdog.reset()
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	b.watchdog.stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,162 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDo(t *testing.T) {
+	SetOptions(Options{
+		Timeout: 100 * time.Millisecond,
+		Retries: 2,
+		Backoff: time.Millisecond,
+	})
+	t.Cleanup(func() { SetOptions(DefaultOptions) })
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "ok")
+		}))
+		defer srv.Close()
+
+		resp, err := Get(context.TODO(), srv.URL)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		_, err := Get(context.TODO(), srv.URL)
+		assert.EqualError(t, err, "expected http 200, but 429")
+		assert.True(t, indexer.IsTransient(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry permanent failures", func(t *testing.T) {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			http.NotFound(w, r)
+		}))
+		defer srv.Close()
+
+		_, err := Get(context.TODO(), srv.URL)
+		assert.EqualError(t, err, "expected http 200, but 404")
+		assert.False(t, indexer.IsTransient(err))
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("does not retry an unsupported scheme", func(t *testing.T) {
+		attempts := countAttempts(t)
+
+		_, err := Get(context.TODO(), "ftp://example.com/packages.json")
+		assert.Error(t, err)
+		assert.False(t, indexer.IsTransient(err))
+		assert.Equal(t, 1, *attempts)
+	})
+
+	t.Run("does not retry tls failures", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+		attempts := countAttempts(t)
+
+		_, err := Get(context.TODO(), srv.URL)
+		var certErr *tls.CertificateVerificationError
+		assert.True(t, errors.As(err, &certErr))
+		assert.False(t, indexer.IsTransient(err))
+		assert.Equal(t, 1, *attempts)
+	})
+
+	t.Run("no response in time", func(t *testing.T) {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+
+		_, err := Get(context.TODO(), srv.URL)
+		assert.EqualError(t, err, "no response in 100ms")
+		assert.True(t, indexer.IsTransient(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("download stalled", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "part")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+
+		resp, err := Get(context.TODO(), srv.URL)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		_, err = io.ReadAll(resp.Body)
+		assert.EqualError(t, err, "download stalled: no data in 100ms")
+		assert.True(t, indexer.IsTransient(err))
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+
+		_, err := Get(ctx, srv.URL)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// countAttempts counts the requests sent by the default client
+// until the end of the test
+func countAttempts(t *testing.T) *int {
+	attempts := 0
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	return &attempts
+}
@@ -0,0 +1,234 @@
+package httputil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+)
+
+const partSuffix = ".part"
+
+// Download downloads the file at the url into the download directory
+// of the index and opens it, so the release is indexed from the disk.
+//
+// An interrupted download is resumed with a Range request, either right away
+// or by the next indexing attempt, and a complete file is never downloaded
+// again. Without the download directory, the file is streamed as is.
+// See `indexer.DownloadDir`
+func Download(ctx context.Context, url string) (io.ReadCloser, error) {
+	dir, ok := indexer.DownloadDir(ctx)
+	if !ok {
+		resp, err := Get(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return indexer.TrackDownload(ctx, resp.Body, resp.ContentLength), nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create download directory: %w", err)
+	}
+
+	// The files of other releases are of no use anymore
+	name := downloadName(url)
+	if err := removeExcept(dir, name); err != nil {
+		return nil, fmt.Errorf("remove previous downloads: %w", err)
+	}
+
+	dst := filepath.Join(dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		return os.Open(dst)
+	}
+
+	if err := resume(ctx, url, dst+partSuffix); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(dst+partSuffix, dst); err != nil {
+		return nil, fmt.Errorf("rename downloaded file: %w", err)
+	}
+
+	return os.Open(dst)
+}
+
+// downloadName is unique for every url, but still tells what the file is
+func downloadName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8]) + "-" + path.Base(url)
+}
+
+func removeExcept(dir, name string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.TrimSuffix(entry.Name(), partSuffix) == name {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resume continues the download into the partial file. Like `Do`, it
+// retries the transient failures, but the attempts are counted only
+// while the download makes no progress
+func resume(ctx context.Context, url, part string) error {
+	o := getOptions()
+	backoff := o.Backoff
+	failures := 0
+
+	for {
+		written, err := downloadPart(ctx, url, part, o.Timeout)
+		if err == nil {
+			return nil
+		}
+		if written > 0 {
+			failures, backoff = 0, o.Backoff
+		}
+
+		var transient *indexer.TransientError
+		if !errors.As(err, &transient) || failures >= o.Retries || ctx.Err() != nil {
+			return err
+		}
+		failures++
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// downloadPart appends the rest of the file to the partial
+// file. It returns the number of the appended bytes
+func downloadPart(ctx context.Context, url, part string, timeout time.Duration) (int64, error) {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("open partial file: %w", err)
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("seek partial file: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := do(req, timeout)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusRequestedRangeNotSatisfiable {
+		// The partial file has the whole file already, if a previous
+		// attempt failed right after downloading it
+		if total, ok := unsatisfiedRangeTotal(status.Header.Get("Content-Range")); ok && total == offset {
+			return 0, file.Close()
+		}
+		// The partial file does not match the file on the server, start over
+		return 0, restart(file, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	size := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return 0, restart(file, errors.New("unexpected content range"))
+		}
+		size = total
+	case http.StatusOK:
+		// The server ignored the range, so the whole file is sent
+		if err := file.Truncate(0); err != nil {
+			return 0, fmt.Errorf("truncate partial file: %w", err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("seek partial file: %w", err)
+		}
+		offset = 0
+		size = resp.ContentLength
+	default:
+		return 0, &StatusError{Code: resp.StatusCode}
+	}
+
+	body := indexer.TrackResumedDownload(ctx, resp.Body, offset, size)
+	written, err := io.Copy(file, body)
+	if err != nil {
+		return written, fmt.Errorf("download: %w", err)
+	}
+	if size >= 0 && offset+written != size {
+		return written, &indexer.TransientError{Err: fmt.Errorf("downloaded %d of %d bytes", offset+written, size)}
+	}
+
+	return written, file.Close()
+}
+
+// restart truncates the partial file, so the next attempt downloads the whole
+// file. The error is transient, because the next attempt is expected to succeed
+func restart(file *os.File, cause error) error {
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate partial file: %w", err)
+	}
+	return &indexer.TransientError{Err: cause}
+}
+
+// unsatisfiedRangeTotal parses the `bytes */total` header of
+// the responses to the ranges past the end of the file
+func unsatisfiedRangeTotal(header string) (int64, bool) {
+	totalStr, ok := strings.CutPrefix(header, "bytes */")
+	if !ok {
+		return 0, false
+	}
+
+	total, err := strconv.ParseInt(totalStr, 10, 64)
+	return total, err == nil
+}
+
+// parseContentRange parses the `bytes start-end/total` header.
+// The total is -1 if it is unknown
+func parseContentRange(header string) (int64, int64, bool) {
+	rng, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	rng, totalStr, _ := strings.Cut(rng, "/")
+	startStr, _, _ := strings.Cut(rng, "-")
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total, err := strconv.ParseInt(totalStr, 10, 64)
+	if err != nil {
+		total = -1
+	}
+
+	return start, total, true
+}
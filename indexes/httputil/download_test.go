@@ -0,0 +1,193 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("nix-search-tv "), 1000)
+
+	// dropping serves the content, but drops the connection
+	// in the middle of the first `drops` responses
+	type server struct {
+		url    string
+		ranges []string
+	}
+	dropping := func(t *testing.T, drops int) *server {
+		s := &server{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+			if len(s.ranges) > drops {
+				http.ServeContent(w, r, "packages.json.br", time.Time{}, bytes.NewReader(content))
+				return
+			}
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:4000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}))
+		t.Cleanup(srv.Close)
+
+		s.url = srv.URL + "/packages.json.br"
+		return s
+	}
+
+	setOptions := func(t *testing.T, retries int) {
+		SetOptions(Options{Timeout: time.Second, Retries: retries, Backoff: time.Millisecond})
+		t.Cleanup(func() { SetOptions(DefaultOptions) })
+	}
+
+	download := func(t *testing.T, ctx context.Context, url string) ([]byte, error) {
+		t.Helper()
+
+		rd, err := Download(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		defer rd.Close()
+
+		return io.ReadAll(rd)
+	}
+
+	t.Run("resumes dropped connection", func(t *testing.T) {
+		setOptions(t, 1)
+		srv := dropping(t, 1)
+		ctx := indexer.WithDownloadDir(context.TODO(), t.TempDir())
+
+		data, err := download(t, ctx, srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, []string{"", "bytes=4000-"}, srv.ranges)
+	})
+
+	t.Run("resumes on the next attempt", func(t *testing.T) {
+		setOptions(t, 0)
+		srv := dropping(t, 1)
+		dir := t.TempDir()
+		ctx := indexer.WithDownloadDir(context.TODO(), dir)
+
+		_, err := download(t, ctx, srv.url)
+		assert.Error(t, err)
+		assert.True(t, indexer.IsTransient(err))
+
+		data, err := download(t, ctx, srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, []string{"", "bytes=4000-"}, srv.ranges)
+
+		// The complete file is not downloaded again
+		data, err = download(t, ctx, srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, 2, len(srv.ranges))
+	})
+
+	t.Run("server ignores the range", func(t *testing.T) {
+		setOptions(t, 0)
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write(content)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		url := srv.URL + "/packages.json.br"
+		err := os.WriteFile(filepath.Join(dir, downloadName(url)+partSuffix), []byte("garbage"), 0644)
+		assert.NoError(t, err)
+
+		data, err := download(t, indexer.WithDownloadDir(context.TODO(), dir), url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("partial file is complete", func(t *testing.T) {
+		setOptions(t, 0)
+		srv := dropping(t, 0)
+		dir := t.TempDir()
+
+		// The previous attempt failed before the file was renamed
+		err := os.WriteFile(filepath.Join(dir, downloadName(srv.url)+partSuffix), content, 0644)
+		assert.NoError(t, err)
+
+		data, err := download(t, indexer.WithDownloadDir(context.TODO(), dir), srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, []string{"bytes=" + strconv.Itoa(len(content)) + "-"}, srv.ranges)
+	})
+
+	t.Run("partial file is bigger than the file", func(t *testing.T) {
+		setOptions(t, 1)
+		srv := dropping(t, 0)
+		dir := t.TempDir()
+
+		err := os.WriteFile(filepath.Join(dir, downloadName(srv.url)+partSuffix), append(content, "garbage"...), 0644)
+		assert.NoError(t, err)
+
+		data, err := download(t, indexer.WithDownloadDir(context.TODO(), dir), srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, 2, len(srv.ranges))
+	})
+
+	t.Run("removes other downloads", func(t *testing.T) {
+		setOptions(t, 0)
+		srv := dropping(t, 0)
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "old-packages.json.br"), nil, 0644))
+
+		_, err := download(t, indexer.WithDownloadDir(context.TODO(), dir), srv.url)
+		assert.NoError(t, err)
+
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+		assert.Equal(t, downloadName(srv.url), entries[0].Name())
+	})
+
+	t.Run("streams without the download directory", func(t *testing.T) {
+		setOptions(t, 0)
+		srv := dropping(t, 0)
+
+		data, err := download(t, context.TODO(), srv.url)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+	})
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, ok := parseContentRange("bytes 100-999/1000")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), start)
+	assert.Equal(t, int64(1000), total)
+
+	start, total, ok = parseContentRange("bytes 100-999/*")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), start)
+	assert.Equal(t, int64(-1), total)
+
+	_, _, ok = parseContentRange("items 1-2/3")
+	assert.False(t, ok)
+
+	total, ok = unsatisfiedRangeTotal("bytes */1000")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1000), total)
+
+	_, ok = unsatisfiedRangeTotal("bytes */*")
+	assert.False(t, ok)
+}
@@ -0,0 +1,125 @@
+// Package httputil fetches web pages that have no releases of their own,
+// like the options pages of home-manager or nix-darwin
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The release of a page tells how its content can be checked for changes
+const (
+	etagPrefix         = "etag:"
+	lastModifiedPrefix = "last-modified:"
+	sha256Prefix       = "sha256:"
+)
+
+// Page is a web page, that is downloaded only when it changes.
+//
+// The release of the page is built from its ETag, Last-Modified or, if the
+// server sends neither, from the hash of the content. The same release
+// is returned for as long as the page stays the same, so the index is not
+// rebuilt. The content of a changed page, downloaded while checking the
+// release, is kept for the following `Open`, so it is downloaded only once.
+// The content of an unchanged page is dropped, as it is not indexed
+type Page struct {
+	mu      sync.Mutex
+	release string
+	content []byte
+}
+
+// Release returns the current release of the page at the url,
+// given the release the index is currently built from
+func (p *Page) Release(ctx context.Context, url, current string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	if etag, ok := strings.CutPrefix(current, etagPrefix); ok {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified, ok := strings.CutPrefix(current, lastModifiedPrefix); ok {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+
+	resp, err := Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		p.keep("", nil)
+		return current, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("expected http 200, but %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read page: %w", err)
+	}
+
+	release := ""
+	switch {
+	case resp.Header.Get("ETag") != "":
+		release = etagPrefix + resp.Header.Get("ETag")
+	case resp.Header.Get("Last-Modified") != "":
+		release = lastModifiedPrefix + resp.Header.Get("Last-Modified")
+	default:
+		sum := sha256.Sum256(content)
+		release = sha256Prefix + hex.EncodeToString(sum[:])
+	}
+
+	// Servers ignoring the conditional headers, and the pages
+	// without them, send the unchanged content again
+	if release == current {
+		p.keep("", nil)
+		return current, nil
+	}
+
+	p.keep(release, content)
+	return release, nil
+}
+
+// keep keeps the content of the release for the following `Open`
+func (p *Page) keep(release string, content []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.release = release
+	p.content = content
+}
+
+// Open returns the content of the given release of the page. If the
+// content is not kept since the `Release` call, it is downloaded again
+func (p *Page) Open(ctx context.Context, url, release string) (io.ReadCloser, error) {
+	p.mu.Lock()
+	if p.content != nil && p.release == release {
+		content := p.content
+		p.release, p.content = "", nil
+		p.mu.Unlock()
+
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	p.mu.Unlock()
+
+	resp, err := Get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch page: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected http 200, but %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
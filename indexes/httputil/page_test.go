@@ -0,0 +1,88 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestPage(t *testing.T) {
+	content := "v1"
+	downloads := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			etag := `"` + content + `"`
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		case "/last-modified":
+			modified := "Mon, 02 Jan 2006 15:04:05 GMT"
+			if content == "v2" {
+				modified = "Tue, 03 Jan 2006 15:04:05 GMT"
+			}
+			if r.Header.Get("If-Modified-Since") == modified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", modified)
+		}
+
+		downloads++
+		io.WriteString(w, content)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/etag", "/last-modified", "/hash"} {
+		t.Run(strings.TrimPrefix(path, "/"), func(t *testing.T) {
+			content, downloads = "v1", 0
+			page := Page{}
+			url := srv.URL + path
+
+			first, err := page.Release(context.TODO(), url, "")
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", readPage(t, &page, url, first))
+			assert.Equal(t, 1, downloads)
+
+			same, err := page.Release(context.TODO(), url, first)
+			assert.NoError(t, err)
+			assert.Equal(t, first, same)
+			// The unchanged page is not indexed, so it is not kept
+			assert.Equal(t, []byte(nil), page.content)
+
+			content = "v2"
+			second, err := page.Release(context.TODO(), url, first)
+			assert.NoError(t, err)
+			assert.NotEqual(t, first, second)
+			assert.Equal(t, "v2", readPage(t, &page, url, second))
+		})
+	}
+
+	t.Run("downloads again if not kept", func(t *testing.T) {
+		content, downloads = "v1", 0
+		page := Page{}
+
+		assert.Equal(t, "v1", readPage(t, &page, srv.URL, "sha256:unknown"))
+		assert.Equal(t, 1, downloads)
+	})
+}
+
+func readPage(t *testing.T, page *Page, url, release string) string {
+	t.Helper()
+
+	rd, err := page.Open(context.TODO(), url, release)
+	assert.NoError(t, err)
+	defer rd.Close()
+
+	data, err := io.ReadAll(rd)
+	assert.NoError(t, err)
+	return string(data)
+}
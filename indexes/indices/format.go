@@ -0,0 +1,105 @@
+package indices
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+	"github.com/3timeslazy/nix-search-tv/style"
+)
+
+// PlainPreview is the same as `Preview`, but without the terminal styles
+func PlainPreview(index string, out io.Writer, pkgContent json.RawMessage) error {
+	buf := &bytes.Buffer{}
+	if err := Preview(index, buf, pkgContent); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(out, style.StripANSI(buf.String()))
+	return err
+}
+
+// JSONPreview prints the normalized package fields as json. See `pkginfo.Info`
+func JSONPreview(index string, out io.Writer, pkgContent json.RawMessage) error {
+	pkg, err := getPkg(index, pkgContent)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(pkg.GetInfo())
+}
+
+// MarkdownPreview prints the normalized package fields
+// as markdown, suitable for pasting into issues
+func MarkdownPreview(index string, out io.Writer, pkgContent json.RawMessage) error {
+	pkg, err := getPkg(index, pkgContent)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, markdown(pkg.GetInfo()))
+	return err
+}
+
+func markdown(info pkginfo.Info) string {
+	sb := strings.Builder{}
+
+	title := "### `" + info.Name + "`"
+	if info.Version != "" {
+		title += " " + info.Version
+	}
+	sb.WriteString(title + "\n\n")
+
+	if desc := strings.TrimSpace(info.Description); desc != "" {
+		sb.WriteString(desc + "\n\n")
+	}
+
+	props := []string{}
+	prop := func(name string, values []string) {
+		if len(values) > 0 {
+			props = append(props, fmt.Sprintf("- **%s:** %s", name, strings.Join(values, ", ")))
+		}
+	}
+	if info.Type != "" {
+		prop("Type", []string{"`" + info.Type + "`"})
+	}
+	prop("Homepage", links(info.Homepages))
+	prop("License", info.Licenses)
+	prop("Platforms", info.Platforms)
+	prop("Declared in", links(info.Declarations))
+	if len(props) > 0 {
+		sb.WriteString(strings.Join(props, "\n") + "\n\n")
+	}
+
+	if info.Default != "" {
+		sb.WriteString("**Default:**\n\n" + codeBlock(info.Default) + "\n\n")
+	}
+	if info.Example != "" {
+		sb.WriteString("**Example:**\n\n" + codeBlock(info.Example) + "\n\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// links turns urls into markdown autolinks, and
+// everything else, like file paths, into code spans
+func links(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://") {
+			out = append(out, "<"+v+">")
+		} else {
+			out = append(out, "`"+v+"`")
+		}
+	}
+	return out
+}
+
+func codeBlock(code string) string {
+	return "```nix\n" + strings.TrimSpace(code) + "\n```"
+}
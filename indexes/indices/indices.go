@@ -10,6 +10,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
 	"github.com/3timeslazy/nix-search-tv/indexes/darwin"
@@ -17,12 +20,15 @@ import (
 	"github.com/3timeslazy/nix-search-tv/indexes/nixos"
 	"github.com/3timeslazy/nix-search-tv/indexes/nixpkgs"
 	"github.com/3timeslazy/nix-search-tv/indexes/nur"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
+	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
 )
 
 type Pkg interface {
 	Preview(io.Writer)
 	GetSource() string
 	GetHomepage() string
+	GetInfo() pkginfo.Info
 }
 
 const (
@@ -75,16 +81,94 @@ func Register(
 	return nil
 }
 
+// previewTemplates are the templates replacing
+// the default previews of the indexes
+var previewTemplates = map[string]string{}
+
+// SetPreviewTemplate replaces the default preview of the index with the
+// template. Besides the package fields, the template can read any field
+// of the package JSON with `field "meta.maintainers"`
+func SetPreviewTemplate(index string, text string) error {
+	if _, err := parsePreviewTemplate(index, text, nil); err != nil {
+		return err
+	}
+
+	previewTemplates[index] = text
+	return nil
+}
+
 func Preview(index string, out io.Writer, pkgContent json.RawMessage) error {
 	pkg, err := getPkg(index, pkgContent)
 	if err != nil {
 		return err
 	}
 
-	pkg.Preview(out)
+	text, ok := previewTemplates[index]
+	if !ok {
+		pkg.Preview(out)
+		return nil
+	}
+
+	tmpl, err := parsePreviewTemplate(index, text, pkgContent)
+	if err != nil {
+		return err
+	}
+	if err = tmpl.Execute(out, pkg); err != nil {
+		return fmt.Errorf("render preview: %w", err)
+	}
 	return nil
 }
 
+func parsePreviewTemplate(index string, text string, pkgContent json.RawMessage) (*template.Template, error) {
+	// The package JSON is decoded once per preview, and only
+	// if the template reads any field, however many it reads
+	decode := sync.OnceValues(func() (any, error) {
+		return decodeFields(pkgContent)
+	})
+
+	tmpl, err := textutil.ParseTemplate(index, text, template.FuncMap{
+		"field": func(path string) (any, error) {
+			fields, err := decode()
+			if err != nil {
+				return nil, err
+			}
+			return lookupField(fields, path), nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parse preview template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// decodeFields decodes the package JSON for `lookupField`
+func decodeFields(pkgContent json.RawMessage) (any, error) {
+	if len(pkgContent) == 0 {
+		return nil, nil
+	}
+
+	var fields any
+	if err := json.Unmarshal(pkgContent, &fields); err != nil {
+		return nil, fmt.Errorf("unmarshal package: %w", err)
+	}
+	return fields, nil
+}
+
+// lookupField returns the value at the dot-separated path
+// in the decoded package JSON, or nil if there is no such field
+func lookupField(fields any, path string) any {
+	value := fields
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = obj[key]
+	}
+
+	return value
+}
+
 func SourcePreview(index string, out io.Writer, pkgContent json.RawMessage) error {
 	pkg, err := getPkg(index, pkgContent)
 	if err != nil {
@@ -114,6 +198,16 @@ func registerNewPkg(index string, newpkg func() Pkg) error {
 	return nil
 }
 
+// GetInfo returns the normalized fields of the package. See `pkginfo.Info`
+func GetInfo(index string, pkgContent json.RawMessage) (pkginfo.Info, error) {
+	pkg, err := getPkg(index, pkgContent)
+	if err != nil {
+		return pkginfo.Info{}, err
+	}
+
+	return pkg.GetInfo(), nil
+}
+
 func getPkg(index string, pkgContent json.RawMessage) (Pkg, error) {
 	newPkg, ok := newPkgs[index]
 	if !ok {
@@ -151,4 +245,5 @@ func SetFetchers(newFetchers map[string]indexer.Fetcher) {
 func Reset() {
 	fetchers = map[string]indexer.Fetcher{}
 	newPkgs = map[string]func() Pkg{}
+	previewTemplates = map[string]string{}
 }
@@ -5,65 +5,45 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
-	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
+	"github.com/3timeslazy/nix-search-tv/indexes/nixreleases"
 	"github.com/3timeslazy/nix-search-tv/indexes/readutil"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-type Fetcher struct{}
+type Fetcher struct {
+	// Channel is the channel the options are taken from, like `nixos-24.11`.
+	// The default is `nixos-unstable`
+	Channel string
+}
 
-const prefix = "nixos/unstable/"
+func NewFetcher(channel string) *Fetcher {
+	return &Fetcher{
+		Channel: channel,
+	}
+}
 
-func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
-	s3client := s3.NewFromConfig(aws.Config{
-		Region: "eu-west-1",
-	})
+func (f *Fetcher) channel() string {
+	return cmp.Or(f.Channel, nixreleases.NixOSUnstable)
+}
 
-	// The `startAfter` is a marker for S3 to start iterating from. Just use the latest
-	// at the moment of writing nixpkgs release to never iterate from the beginning
-	startAfter := cmp.Or(md.CurrRelease, "nixos/unstable/nixos-25.05beta751650.64e75cd44acf")
-	var latest types.Object
-	input := &s3.ListObjectsV2Input{
-		Bucket:     aws.String("nix-releases"),
-		Prefix:     aws.String(prefix),
-		Delimiter:  aws.String("/"),
-		StartAfter: aws.String(startAfter),
-	}
-	p := s3.NewListObjectsV2Paginator(s3client, input)
-	for p.HasMorePages() {
-		page, err := p.NextPage(ctx)
-		if err != nil {
-			return "", fmt.Errorf("get next page: %w", err)
-		}
-		for _, obj := range page.Contents {
-			latest = obj
-		}
-	}
+func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return nixreleases.LatestRelease(ctx, f.channel(), md)
+}
 
-	if latest.Key == nil {
-		return md.CurrRelease, nil
-	}
-	return *latest.Key, nil
+// ResolveRevision returns the release built from the git revision
+func (f *Fetcher) ResolveRevision(ctx context.Context, revision string) (string, error) {
+	return nixreleases.ResolveRevision(ctx, f.channel(), revision)
 }
 
 func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
-	release = strings.TrimPrefix(release, prefix)
-	url, _ := url.JoinPath("https://releases.nixos.org/nixos/unstable", release, "options.json.br")
+	url := nixreleases.DownloadURL(release, "options.json.br")
 
-	resp, err := http.Get(url)
+	body, err := httputil.Download(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("fetch packages: %w", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("expected http 200, but %d", resp.StatusCode)
-	}
 
-	return readutil.PackagesWrapper(readutil.NewBrotli(resp.Body)), nil
+	return readutil.PackagesWrapper(readutil.NewBrotli(body)), nil
 }
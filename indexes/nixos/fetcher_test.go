@@ -3,6 +3,7 @@ package nixos
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"os"
 	"slices"
 	"strings"
@@ -32,7 +33,7 @@ func TestFetcherOutput(t *testing.T) {
 	assert.NoError(t, err)
 	actualKeys := bytes.Buffer{}
 
-	err = indexer.Index(pkgsWrap, &actualKeys)
+	err = indexer.Index(pkgsWrap, &actualKeys, io.Discard)
 	assert.NoError(t, err)
 
 	expectedLines := strings.Split(string(expectedKeys), "\n")
@@ -1,12 +1,12 @@
 package nixos
 
 import (
+	"cmp"
 	"fmt"
-	"io"
+	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
-	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
 )
 
 type Package struct {
@@ -16,61 +16,46 @@ type Package struct {
 	Description  string   `json:"description"`
 	Declarations []string `json:"declarations"`
 	Default      Example  `json:"default"`
+
+	// Channel is the channel the option comes from. It
+	// is not a part of the option and is set by the index
+	Channel string `json:"-"`
 }
 
 type Example struct {
 	Text string `json:"text"`
 }
 
-func (pkg *Package) Preview(out io.Writer) {
-	styler := style.StyledText
-
-	pkgTitle := textutil.PkgName(pkg.Name) + "\n"
-	fmt.Fprint(out, pkgTitle)
-
-	desc := style.StyleLongDescription(styler, pkg.Description)
-	desc += "\n"
-	fmt.Fprintln(out, desc)
-
-	typ := textutil.Prop("type", "", pkg.Type)
-	fmt.Fprintln(out, typ)
-
-	def := pkg.Default.Text
-	if def != "" {
-		def = textutil.Prop(
-			"default", "",
-			style.PrintCodeBlock(def),
-		)
-		fmt.Fprintln(out, def)
-	}
-
-	example := ""
-	if pkg.Example.Text != "" {
-		example = textutil.Prop(
-			"example", "",
-			style.PrintCodeBlock(pkg.Example.Text),
-		)
-		fmt.Fprintln(out, example)
-	}
-}
-
 func (pkg *Package) GetSource() string {
+	channel := cmp.Or(pkg.Channel, "nixos-unstable")
 	if len(pkg.Declarations) == 1 {
-		return fmt.Sprintf("https://github.com/NixOS/nixpkgs/blob/nixos-unstable/%s", pkg.Declarations[0])
+		return fmt.Sprintf("https://github.com/NixOS/nixpkgs/blob/%s/%s", channel, pkg.Declarations[0])
 	}
 
 	return fmt.Sprintf(
 		"https://search.nixos.org/options?"+
-			"channel=unstable"+
+			"channel=%[2]s"+
 			"&from=0&size=1"+
 			"&sort=relevances&query=%[1]s"+
 			// `show` automatically expands the package definion
 			// on the search page. Save users a click!
 			"&show=%[1]s",
 		pkg.Name,
+		strings.TrimPrefix(channel, "nixos-"),
 	)
 }
 
 func (pkg *Package) GetHomepage() string {
 	return pkg.GetSource()
 }
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	return pkginfo.Info{
+		Name:         pkg.Name,
+		Description:  pkg.Description,
+		Type:         pkg.Type,
+		Default:      pkg.Default.Text,
+		Example:      pkg.Example.Text,
+		Declarations: pkg.Declarations,
+	}
+}
@@ -1,41 +1,24 @@
 package nixos
 
 import (
-	"fmt"
 	"io"
 
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
 )
 
-func Preview(out io.Writer, pkg Package) {
-	styler := style.StyledText
+// PreviewTemplate is the default preview of the options
+const PreviewTemplate = `{{ name .Name }}
+{{ markdown .Description }}
 
-	pkgTitle := textutil.PkgName(pkg.Name) + "\n"
-	fmt.Fprint(out, pkgTitle)
+{{ prop "type" "" .Type }}
+{{ with .Default.Text }}{{ prop "default" "" (code .) }}
+{{ end -}}
+{{ with .Example.Text }}{{ prop "example" "" (code .) }}
+{{ end -}}
+`
 
-	desc := style.StyleLongDescription(styler, pkg.Description)
-	desc += "\n"
-	fmt.Fprintln(out, desc)
+var previewTemplate = textutil.MustParseTemplate("nixos", PreviewTemplate)
 
-	typ := textutil.Prop("type", "", pkg.Type)
-	fmt.Fprintln(out, typ)
-
-	def := pkg.Default.Text
-	if def != "" {
-		def = textutil.Prop(
-			"default", "",
-			style.PrintCodeBlock(def),
-		)
-		fmt.Fprintln(out, def)
-	}
-
-	example := ""
-	if pkg.Example.Text != "" {
-		example = textutil.Prop(
-			"example", "",
-			style.PrintCodeBlock(pkg.Example.Text),
-		)
-		fmt.Fprintln(out, example)
-	}
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
@@ -2,9 +2,14 @@ package nixpkgs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -36,7 +41,7 @@ func TestFetcherOutput(t *testing.T) {
 	assert.NoError(t, err)
 	actualKeys := bytes.Buffer{}
 
-	err = indexer.Index(pkgsbr, &actualKeys)
+	err = indexer.Index(pkgsbr, &actualKeys, io.Discard)
 	assert.NoError(t, err)
 
 	expectedLines := strings.Split(string(expectedKeys), "\n")
@@ -56,3 +61,68 @@ func TestFetcherOutput(t *testing.T) {
 		}
 	}
 }
+
+// BenchmarkStorageLoad compares the latency of opening an index and
+// loading a package, which is what every preview does
+func BenchmarkStorageLoad(b *testing.B) {
+	for _, storage := range []string{indexer.StorageBadger, indexer.StorageCompact} {
+		b.Run(storage, func(b *testing.B) {
+			cacheDir := b.TempDir()
+			keys := indexTestdata(b, cacheDir, storage)
+
+			b.ResetTimer()
+			for i := range b.N {
+				_, err := indexer.LoadKey(cacheDir, "nixpkgs", keys[i%len(keys)])
+				assert.NoError(b, err)
+			}
+		})
+	}
+}
+
+// indexTestdata indexes generated packages, shaped like the
+// nixpkgs ones, so that the benchmark does not need a release
+func indexTestdata(b *testing.B, cacheDir, storage string) []string {
+	b.Helper()
+
+	pkgs := indexer.Indexable{Packages: map[string]json.RawMessage{}}
+	for i := range 20_000 {
+		pkg, err := json.Marshal(map[string]any{
+			"version": "1.0." + strconv.Itoa(i),
+			"meta": Meta{
+				Description:     fmt.Sprintf("Package number %d of the benchmark", i),
+				LongDescription: strings.Repeat("A longer description of the package. ", 10),
+				Homepages:       []string{fmt.Sprintf("https://example.com/pkg-%05d", i)},
+			},
+		})
+		assert.NoError(b, err)
+		pkgs.Packages[fmt.Sprintf("pkg-%05d", i)] = pkg
+	}
+	data, err := json.Marshal(pkgs)
+	assert.NoError(b, err)
+
+	results := indexer.RunIndexing(
+		context.Background(),
+		indexer.Options{CacheDir: cacheDir, Storage: storage},
+		[]indexer.Index{{Name: "nixpkgs", Fetcher: &fileFetcher{io.NopCloser(bytes.NewReader(data))}}},
+	)
+	for result := range results {
+		assert.NoError(b, result.Err)
+	}
+
+	keys, err := os.ReadFile(filepath.Join(cacheDir, "nixpkgs", "cache.txt"))
+	assert.NoError(b, err)
+
+	return strings.Fields(string(keys))
+}
+
+type fileFetcher struct {
+	pkgs io.ReadCloser
+}
+
+func (f *fileFetcher) GetLatestRelease(context.Context, indexer.IndexMetadata) (string, error) {
+	return "testdata", nil
+}
+
+func (f *fileFetcher) DownloadRelease(context.Context, string) (io.ReadCloser, error) {
+	return f.pkgs, nil
+}
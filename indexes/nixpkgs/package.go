@@ -7,12 +7,21 @@ import (
 	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
 )
 
 type Package struct {
 	indexer.Package
 	Meta    Meta   `json:"meta"`
 	Version string `json:"version"`
+
+	// Channel is the channel the package comes from. It
+	// is not a part of the package and is set by the index
+	Channel string `json:"-"`
+
+	// Local is set for the packages of a local file, which
+	// positions are not in the nixpkgs repository
+	Local bool `json:"-"`
 }
 
 type Meta struct {
@@ -102,3 +111,19 @@ func (pkg *Package) GetVersion() string {
 	// TODO: comment about nvidia-docker
 	return strings.TrimPrefix(pkg.Meta.Name, pkg.Name+"-")
 }
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	info := pkginfo.Info{
+		Name:        pkg.Name,
+		Version:     pkg.GetVersion(),
+		Description: pkg.Meta.Description,
+		Licenses:    licenseNames(pkg.Meta.Licenses),
+		Homepages:   pkg.Meta.Homepages,
+		Platforms:   pkg.Meta.Platforms,
+	}
+	if pkg.Meta.Position != "" {
+		info.Declarations = []string{pkg.Meta.Position}
+	}
+
+	return info
+}
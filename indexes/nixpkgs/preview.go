@@ -2,87 +2,61 @@ package nixpkgs
 
 import (
 	"cmp"
-	"fmt"
 	"io"
+	"path"
 	"strings"
 
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
 )
 
-func (pkg *Package) Preview(out io.Writer) {
-	styler := style.StyledText
-
-	pkgTitle := textutil.PkgName(pkg.Name) + " " + styler.Dim("("+pkg.GetVersion()+")")
-	if pkg.Meta.Broken {
-		pkgTitle += " " + styler.Red("(broken)")
-	}
-	fmt.Fprintln(out, pkgTitle)
-
-	desc := ""
-	if pkg.Meta.Description != "" {
-		desc = style.Wrap(pkg.Meta.Description) + "\n"
-	}
-	fmt.Fprintln(out, desc)
-
-	// A small hack, mostly for gnomeExtensions.* packages. These packages' long descriptions
-	// usually start with the main description. It looks fine at search.nixos.org, but not here
-	pkg.Meta.LongDescription = strings.TrimPrefix(pkg.Meta.LongDescription, pkg.Meta.Description)
-
-	if pkg.Meta.LongDescription != "" && pkg.Meta.Description != pkg.Meta.LongDescription {
-		longDesc := style.StyleLongDescription(styler, pkg.Meta.LongDescription)
-		longDesc += "\n"
-		fmt.Fprintln(out, longDesc)
-	}
-
-	homepages := ""
-	if hmpgs := len(pkg.Meta.Homepages); hmpgs > 0 {
-		homepages = textutil.Prop(
-			textutil.IfElse(hmpgs == 1, "homepage", "homepages"), "",
-			strings.Join(pkg.Meta.Homepages, "\n"),
-		)
-		fmt.Fprintln(out, homepages)
-	}
-
-	licenseType := textutil.IfElse(pkg.Meta.Unfree, "unfree", "free")
-	license := textutil.Prop(
-		"license", styler.Dim("("+licenseType+")"),
-		licensesString(pkg.Meta.Licenses),
-	)
-	fmt.Fprintln(out, license)
+// PreviewTemplate is the default preview of the packages.
+//
+// A small hack for the long description, mostly for gnomeExtensions.* packages. These packages'
+// long descriptions usually start with the main description. It looks fine at search.nixos.org,
+// but not here, so the main description is trimmed from the long one
+const PreviewTemplate = `{{ name .Name }} {{ dim (printf "(%s)" .GetVersion) }}{{ if .Meta.Broken }} {{ red "(broken)" }}{{ end }}
+{{ if .Meta.Description }}{{ wrap .Meta.Description }}
+{{ end }}
+{{ $long := trimPrefix .Meta.LongDescription .Meta.Description -}}
+{{ if and $long (ne $long .Meta.Description) }}{{ markdown $long }}
+
+{{ end -}}
+{{ with .Meta.Homepages }}{{ prop (ifElse (eq (len .) 1) "homepage" "homepages") "" (join . "\n") }}
+{{ end -}}
+{{ prop "license" (dim (printf "(%s)" (ifElse .Meta.Unfree "unfree" "free"))) .LicenseNames }}
+{{ with .Meta.MainProgram }}{{ prop "main program" "" (code (print "$ " .)) }}
+{{ end -}}
+{{ with .Meta.Platforms }}{{ prop "platforms" "" (platforms .) }}
+{{ end -}}
+`
+
+var previewTemplate = textutil.MustParseTemplate("nixpkgs", PreviewTemplate)
 
-	mainProg := ""
-	if pkg.Meta.MainProgram != "" {
-		mainProg = textutil.Prop(
-			"main program", "",
-			style.PrintCodeBlock("$ "+pkg.Meta.MainProgram),
-		)
-		fmt.Fprintln(out, mainProg)
-	}
-
-	platforms := ""
-	if len(pkg.Meta.Platforms) > 0 {
-		platforms = textutil.Prop(
-			"platforms", "",
-			textutil.Platforms(pkg.Meta.Platforms),
-		)
-		fmt.Fprintln(out, platforms)
-	}
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
 
-func licensesString(ls []License) string {
-	if len(ls) == 0 {
+// LicenseNames returns the SPDX ids, or the full names if there
+// are no ids, of the package licenses, one per line
+func (pkg *Package) LicenseNames() string {
+	if len(pkg.Meta.Licenses) == 0 {
 		return "No License"
 	}
 
+	return strings.Join(licenseNames(pkg.Meta.Licenses), "\n")
+}
+
+func licenseNames(ls []License) []string {
 	ss := []string{}
 	for _, l := range ls {
 		ss = append(ss, cmp.Or(l.SpdxID, l.FullName))
 	}
 
-	return strings.Join(ss, "\n")
+	return ss
 }
 
+// GetSource returns the link to the package in the nixpkgs repository, or
+// the local path if the package is defined elsewhere, like in an overlay
 func (pkg *Package) GetSource() string {
 	src := pkg.Meta.Position
 	if src == "" {
@@ -90,7 +64,15 @@ func (pkg *Package) GetSource() string {
 	}
 
 	src, _, _ = strings.Cut(src, ":")
-	return "https://github.com/NixOS/nixpkgs/blob/nixos-unstable/" + src
+	if path.IsAbs(src) {
+		return src
+	}
+	if pkg.Local {
+		return ""
+	}
+
+	branch := cmp.Or(pkg.Channel, "nixos-unstable")
+	return "https://github.com/NixOS/nixpkgs/blob/" + branch + "/" + src
 }
 
 func (pkg *Package) GetHomepage() string {
@@ -98,5 +80,9 @@ func (pkg *Package) GetHomepage() string {
 		return pkg.Meta.Homepages[0]
 	}
 
-	return pkg.GetSource()
+	src := pkg.GetSource()
+	if path.IsAbs(src) {
+		return ""
+	}
+	return src
 }
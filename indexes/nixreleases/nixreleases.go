@@ -0,0 +1,304 @@
+// Package nixreleases finds the channel releases in the
+// `nix-releases` bucket, which https://releases.nixos.org is served from
+package nixreleases
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
+)
+
+const (
+	NixpkgsUnstable = "nixpkgs-unstable"
+	NixOSUnstable   = "nixos-unstable"
+)
+
+// Endpoints are the urls the releases are looked up and downloaded from.
+// They can be changed to point to a mirror of releases.nixos.org
+type Endpoints struct {
+	// List is the S3 bucket with the releases, that
+	// supports the ListObjectsV2 API for anonymous users
+	List string
+	// Download is the url the files of the releases are served from
+	Download string
+	// Channels is the url serving the `git-revision`
+	// of the latest release of every channel
+	Channels string
+}
+
+var DefaultEndpoints = Endpoints{
+	List:     "https://nix-releases.s3.amazonaws.com",
+	Download: "https://releases.nixos.org",
+	Channels: "https://channels.nixos.org",
+}
+
+var endpoints = DefaultEndpoints
+
+// SetEndpoints overrides the endpoints. Empty
+// values are replaced with the default ones
+func SetEndpoints(e Endpoints) {
+	endpoints = Endpoints{
+		List:     cmp.Or(e.List, DefaultEndpoints.List),
+		Download: cmp.Or(e.Download, DefaultEndpoints.Download),
+		Channels: cmp.Or(e.Channels, DefaultEndpoints.Channels),
+	}
+}
+
+// ChannelPrefix returns the prefix of the channel releases in the bucket:
+//
+//   - nixpkgs-unstable -> nixpkgs/
+//   - nixos-24.11      -> nixos/24.11/
+//   - nixpkgs-24.11-darwin -> nixpkgs/24.11-darwin/
+func ChannelPrefix(channel string) (string, error) {
+	if channel == NixpkgsUnstable {
+		return "nixpkgs/", nil
+	}
+
+	for _, project := range []string{"nixos", "nixpkgs"} {
+		version, ok := strings.CutPrefix(channel, project+"-")
+		if ok && version != "" && !strings.Contains(version, "/") {
+			return project + "/" + version + "/", nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown channel %q, expected something like nixos-unstable or nixos-24.11", channel)
+}
+
+// knownReleases are the latest releases of the unstable channels at the moment
+// of writing. All unstable channels of a project, like `nixos-unstable` and
+// `nixos-unstable-small`, name the releases the same way, so any of them
+// is a marker for S3 to start iterating the others from
+var knownReleases = map[string]string{
+	"nixpkgs": "nixpkgs-25.05pre747523.95ea544c84eb",
+	"nixos":   "nixos-25.05beta751650.64e75cd44acf",
+}
+
+// reVersion matches the version of a channel, like `24.11` of `24.11-darwin`
+var reVersion = regexp.MustCompile(`^[0-9]+\.[0-9]+`)
+
+// startAfter returns the marker for S3 to start iterating the
+// releases of the channel from, so they are never listed from the
+// beginning of the bucket. The releases of a versioned channel all
+// start with its version, like `nixos/24.11/nixos-24.11.711815.abc`
+func startAfter(prefix string) string {
+	project, version, _ := strings.Cut(strings.TrimSuffix(prefix, "/"), "/")
+	if v := reVersion.FindString(version); v != "" {
+		return prefix + project + "-" + v
+	}
+	if release, ok := knownReleases[project]; ok {
+		return prefix + release
+	}
+	return ""
+}
+
+// LatestRelease returns the latest release of the channel.
+//
+// The release names do not always sort in the order they were
+// released, for example `nixos-25.11beta1` goes before `nixos-25.11pre2`.
+// So the latest release is the one built from the current git revision
+// of the channel, and the last listed release is only used if
+// the revision is not available
+func LatestRelease(ctx context.Context, channel string, md indexer.IndexMetadata) (string, error) {
+	prefix, err := ChannelPrefix(channel)
+	if err != nil {
+		return "", err
+	}
+
+	// The current release is used as the marker only if it is from the
+	// same channel, because the channel of an index can be changed in the config
+	after := startAfter(prefix)
+	if strings.HasPrefix(md.CurrRelease, prefix) {
+		after = md.CurrRelease
+	}
+
+	revision, err := channelRevision(ctx, channel)
+	if err == nil {
+		if strings.HasPrefix(md.CurrRelease, prefix) && indexer.ReleaseHasRevision(md.CurrRelease, revision) {
+			return md.CurrRelease, nil
+		}
+
+		release, err := findRevision(ctx, prefix, after, revision, maxRevisionPages)
+		if err != nil {
+			return "", err
+		}
+		// The marker may be from a newer naming scheme than the
+		// release, so look through the releases of the same year
+		if release == "" && after != "" {
+			release, err = findRevisionInYear(ctx, prefix, after, revision)
+			if err != nil {
+				return "", err
+			}
+		}
+		if release != "" {
+			return release, nil
+		}
+	}
+
+	latest := ""
+	err = listReleases(ctx, prefix, after, maxRevisionPages, func(release string) bool {
+		latest = release
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if latest == "" {
+		return md.CurrRelease, nil
+	}
+	return latest, nil
+}
+
+// ResolveRevision returns the release of the channel built from the git
+// revision. The releases after the marker are looked through first, as
+// the pins are usually recent, and only then the ones before it
+func ResolveRevision(ctx context.Context, channel, revision string) (string, error) {
+	prefix, err := ChannelPrefix(channel)
+	if err != nil {
+		return "", err
+	}
+
+	after := startAfter(prefix)
+	found, err := findRevision(ctx, prefix, after, revision, maxRevisionPages)
+	if err != nil {
+		return "", err
+	}
+	if found == "" && after != "" {
+		found, err = findRevision(ctx, prefix, "", revision, maxRevisionPages)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if found == "" {
+		return "", fmt.Errorf("no release found for revision %s", revision)
+	}
+	return found, nil
+}
+
+// DownloadURL returns the url of a file of the release
+func DownloadURL(release, file string) string {
+	u, _ := url.JoinPath(endpoints.Download, release, file)
+	return u
+}
+
+// findRevision returns the release built from the revision, or nothing if there
+// is none. At most maxPages pages of releases are listed
+func findRevision(ctx context.Context, prefix, after, revision string, maxPages int) (string, error) {
+	found := ""
+	err := listReleases(ctx, prefix, after, maxPages, func(release string) bool {
+		if indexer.ReleaseHasRevision(release, revision) {
+			found = release
+			return false
+		}
+		return true
+	})
+
+	return found, err
+}
+
+// reReleaseYear matches the year of a release name, like `nixos-25.`
+// of `nixos-25.05beta751650.64e75cd44acf`
+var reReleaseYear = regexp.MustCompile(`^[a-z]+-[0-9]+\.`)
+
+// maxRevisionPages bounds the releases listed to find a revision, so
+// that a revision missing from the bucket does not list all of it
+const maxRevisionPages = 10
+
+// findRevisionInYear looks for the release built from the revision
+// among the releases of the same year as the marker
+func findRevisionInYear(ctx context.Context, prefix, marker, revision string) (string, error) {
+	year := reReleaseYear.FindString(strings.TrimPrefix(marker, prefix))
+	if year == "" {
+		return "", nil
+	}
+
+	return findRevision(ctx, prefix+year, "", revision, maxRevisionPages)
+}
+
+// channelRevision returns the git revision of the latest release of the channel
+func channelRevision(ctx context.Context, channel string) (string, error) {
+	u, err := url.JoinPath(endpoints.Channels, channel, "git-revision")
+	if err != nil {
+		return "", fmt.Errorf("build url: %w", err)
+	}
+
+	body, err := get(ctx, u)
+	if err != nil {
+		return "", fmt.Errorf("get channel revision: %w", err)
+	}
+
+	revision := strings.TrimSpace(string(body))
+	if revision == "" {
+		return "", errors.New("empty channel revision")
+	}
+	return revision, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listReleases calls the yield with every release after the given
+// one, in the lexicographical order, until the yield returns false.
+// If there are more than maxPages pages, it fails
+func listReleases(ctx context.Context, prefix, after string, maxPages int, yield func(string) bool) error {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"delimiter": {"/"},
+	}
+	if after != "" {
+		query.Set("start-after", after)
+	}
+
+	for pages := 1; ; pages++ {
+		if pages > maxPages {
+			return fmt.Errorf("no more than %d pages of %s releases are listed", maxPages, prefix)
+		}
+
+		body, err := get(ctx, endpoints.List+"?"+query.Encode())
+		if err != nil {
+			return fmt.Errorf("list releases: %w", err)
+		}
+
+		page := listBucketResult{}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("decode releases: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			if !yield(obj.Key) {
+				return nil
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func get(ctx context.Context, u string) ([]byte, error) {
+	resp, err := httputil.Get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
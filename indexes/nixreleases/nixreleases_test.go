@@ -0,0 +1,203 @@
+package nixreleases
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestChannelPrefix(t *testing.T) {
+	cases := map[string]string{
+		"nixpkgs-unstable":     "nixpkgs/",
+		"nixos-unstable":       "nixos/unstable/",
+		"nixos-24.11":          "nixos/24.11/",
+		"nixos-24.11-small":    "nixos/24.11-small/",
+		"nixpkgs-24.11-darwin": "nixpkgs/24.11-darwin/",
+	}
+	for channel, expected := range cases {
+		prefix, err := ChannelPrefix(channel)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, prefix)
+	}
+
+	for _, channel := range []string{"", "stable", "nixos-", "nixos-../unstable"} {
+		_, err := ChannelPrefix(channel)
+		assert.Error(t, err)
+	}
+}
+
+func TestStartAfter(t *testing.T) {
+	cases := map[string]string{
+		"nixpkgs/":              "nixpkgs/nixpkgs-25.05pre747523.95ea544c84eb",
+		"nixos/unstable/":       "nixos/unstable/nixos-25.05beta751650.64e75cd44acf",
+		"nixos/unstable-small/": "nixos/unstable-small/nixos-25.05beta751650.64e75cd44acf",
+		"nixos/24.11/":          "nixos/24.11/nixos-24.11",
+		"nixos/24.11-small/":    "nixos/24.11-small/nixos-24.11",
+		"nixpkgs/24.11-darwin/": "nixpkgs/24.11-darwin/nixpkgs-24.11",
+	}
+	for prefix, expected := range cases {
+		assert.Equal(t, expected, startAfter(prefix))
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	releases := []string{
+		"nixos/unstable/nixos-25.05beta751650.64e75cd44acf",
+		"nixos/unstable/nixos-25.05pre760000.1111111111aa",
+		"nixos/unstable/nixos-25.11beta800000.2222222222bb",
+		"nixos/unstable/nixos-25.11pre790000.3333333333cc",
+	}
+
+	t.Run("release of the channel revision", func(t *testing.T) {
+		mirror(t, releases, "2222222222bbffffffffffffffffffffffffffff")
+
+		release, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/unstable/nixos-25.11beta800000.2222222222bb", release)
+	})
+
+	t.Run("revision before the marker", func(t *testing.T) {
+		mirror(t, releases, "1111111111aaffffffffffffffffffffffffffff")
+
+		release, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{
+			CurrRelease: "nixos/unstable/nixos-25.11pre790000.3333333333cc",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/unstable/nixos-25.05pre760000.1111111111aa", release)
+	})
+
+	t.Run("revision in an older year", func(t *testing.T) {
+		older := append([]string{"nixos/unstable/nixos-24.11pre700000.4444444444dd"}, releases...)
+		mirror(t, older, "4444444444ddffffffffffffffffffffffffffff")
+
+		// Only the releases of the marker's year are looked through,
+		// so the last listed release is picked instead
+		release, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{
+			CurrRelease: "nixos/unstable/nixos-25.05pre760000.1111111111aa",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/unstable/nixos-25.11pre790000.3333333333cc", release)
+	})
+
+	t.Run("too many releases in the year", func(t *testing.T) {
+		many := []string{}
+		for i := range maxRevisionPages + 1 {
+			many = append(many, fmt.Sprintf("nixos/unstable/nixos-25.05pre%06d.5555555555ee", i))
+		}
+		mirror(t, many, "6666666666ffffffffffffffffffffffffffffff")
+
+		_, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{
+			CurrRelease: many[len(many)-1],
+		})
+		assert.EqualError(t, err, "no more than 10 pages of nixos/unstable/nixos-25. releases are listed")
+	})
+
+	t.Run("too many releases after the marker", func(t *testing.T) {
+		many := []string{}
+		for i := range maxRevisionPages + 1 {
+			many = append(many, fmt.Sprintf("nixos/unstable/nixos-25.11pre%06d.5555555555ee", i))
+		}
+		mirror(t, many, "6666666666ffffffffffffffffffffffffffffff")
+
+		_, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{})
+		assert.EqualError(t, err, "no more than 10 pages of nixos/unstable/ releases are listed")
+	})
+
+	t.Run("release of a versioned channel", func(t *testing.T) {
+		mirror(t, []string{
+			"nixos/24.05/nixos-24.05.1000.7777777777aa",
+			"nixos/24.11/nixos-24.11.1000.8888888888bb",
+			"nixos/24.11/nixos-24.11.2000.9999999999cc",
+		}, "9999999999ccffffffffffffffffffffffffffff")
+
+		release, err := LatestRelease(context.TODO(), "nixos-24.11", indexer.IndexMetadata{})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/24.11/nixos-24.11.2000.9999999999cc", release)
+	})
+
+	t.Run("current release is up to date", func(t *testing.T) {
+		mirror(t, nil, "3333333333ccffffffffffffffffffffffffffff")
+
+		release, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{
+			CurrRelease: "nixos/unstable/nixos-25.11pre790000.3333333333cc",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/unstable/nixos-25.11pre790000.3333333333cc", release)
+	})
+
+	t.Run("last listed release without the channel", func(t *testing.T) {
+		mirror(t, releases, "")
+
+		release, err := LatestRelease(context.TODO(), NixOSUnstable, indexer.IndexMetadata{})
+		assert.NoError(t, err)
+		assert.Equal(t, "nixos/unstable/nixos-25.11pre790000.3333333333cc", release)
+	})
+}
+
+func TestResolveRevision(t *testing.T) {
+	mirror(t, []string{
+		"nixpkgs/nixpkgs-25.05pre747523.95ea544c84eb",
+		"nixpkgs/nixpkgs-25.05pre750000.1111111111aa",
+	}, "")
+
+	release, err := ResolveRevision(context.TODO(), NixpkgsUnstable, "95ea544c84eb")
+	assert.NoError(t, err)
+	assert.Equal(t, "nixpkgs/nixpkgs-25.05pre747523.95ea544c84eb", release)
+
+	_, err = ResolveRevision(context.TODO(), NixpkgsUnstable, "2222222222bb")
+	assert.EqualError(t, err, "no release found for revision 2222222222bb")
+}
+
+// mirror serves the releases, one per page, and the revision
+// of every channel. An empty revision means there are no channels
+func mirror(t *testing.T, releases []string, revision string) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		after := max(query.Get("start-after"), query.Get("continuation-token"))
+
+		page := listBucketResult{}
+		for _, release := range releases {
+			if strings.HasPrefix(release, query.Get("prefix")) && release > after {
+				page.Contents = append(page.Contents, struct {
+					Key string `xml:"Key"`
+				}{release})
+				page.IsTruncated = release != releases[len(releases)-1]
+				page.NextContinuationToken = release
+				break
+			}
+		}
+
+		assert.NoError(t, xml.NewEncoder(w).Encode(page))
+	})
+	mux.HandleFunc("/channels/{channel}/git-revision", func(w http.ResponseWriter, r *http.Request) {
+		if revision == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(revision + "\n"))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { SetEndpoints(Endpoints{}) })
+
+	SetEndpoints(Endpoints{
+		List:     srv.URL + "/bucket",
+		Download: srv.URL + "/download",
+		Channels: srv.URL + "/channels",
+	})
+
+	assert.True(t, slices.IsSorted(releases))
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
 	"github.com/3timeslazy/nix-search-tv/indexes/readutil"
 )
 
@@ -21,7 +22,7 @@ func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata
 		return "", fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httputil.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("github request failed: %w", err)
 	}
@@ -41,6 +42,12 @@ func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata
 	return commits[0].Sha, nil
 }
 
+// ResolveRevision returns the revision as it is, because
+// NUR releases are the commits of the nur-search repository
+func (f *Fetcher) ResolveRevision(ctx context.Context, revision string) (string, error) {
+	return revision, nil
+}
+
 const packagesURL = "https://raw.githubusercontent.com/nix-community/nur-search/%s/data/packages.json"
 
 func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
@@ -50,10 +57,11 @@ func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadC
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httputil.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("github request failed: %w", err)
 	}
 
-	return readutil.PackagesWrapper(resp.Body), nil
+	body := indexer.TrackDownload(ctx, resp.Body, resp.ContentLength)
+	return readutil.PackagesWrapper(body), nil
 }
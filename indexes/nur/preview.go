@@ -1,81 +1,29 @@
 package nur
 
 import (
-	"cmp"
-	"fmt"
 	"io"
-	"strings"
 
-	"github.com/3timeslazy/nix-search-tv/indexes/nixpkgs"
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
 )
 
-func (pkg *Package) Preview(out io.Writer) {
-	styler := style.StyledText
-
-	pkgTitle := textutil.PkgName(pkg.Name) + " " + styler.Dim("("+pkg.GetVersion()+")")
-	if pkg.Meta.Broken {
-		pkgTitle += " " + styler.Red("(broken)")
-	}
-	fmt.Fprintln(out, pkgTitle)
-
-	desc := ""
-	if pkg.Meta.Description != "" {
-		desc = style.Wrap(pkg.Meta.Description) + "\n"
-		fmt.Fprintln(out, desc)
-	}
-
-	longDesc := ""
-	if pkg.Meta.LongDescription != "" && pkg.Meta.Description != pkg.Meta.LongDescription {
-		longDesc = style.StyleLongDescription(styler, pkg.Meta.LongDescription)
-		fmt.Fprintln(out, longDesc)
-	}
-
-	homepages := ""
-	if hmpgs := len(pkg.Meta.Homepages); hmpgs > 0 {
-		homepages = textutil.Prop(
-			textutil.IfElse(hmpgs == 1, "homepage", "homepages"), "",
-			strings.Join(pkg.Meta.Homepages, "\n"),
-		)
-		fmt.Fprintln(out, homepages)
-	}
+// PreviewTemplate is the default preview of the packages
+const PreviewTemplate = `{{ name .Name }} {{ dim (printf "(%s)" .GetVersion) }}{{ if .Meta.Broken }} {{ red "(broken)" }}{{ end }}
+{{ with .Meta.Description }}{{ wrap . }}
 
-	licenseType := textutil.IfElse(pkg.Meta.Unfree, "unfree", "free")
-	license := textutil.Prop(
-		"license", styler.Dim("("+licenseType+")"),
-		licensesString(pkg.Meta.Licenses),
-	)
-	fmt.Fprintln(out, license)
+{{ end -}}
+{{ if and .Meta.LongDescription (ne .Meta.Description .Meta.LongDescription) }}{{ markdown .Meta.LongDescription }}
+{{ end -}}
+{{ with .Meta.Homepages }}{{ prop (ifElse (eq (len .) 1) "homepage" "homepages") "" (join . "\n") }}
+{{ end -}}
+{{ prop "license" (dim (printf "(%s)" (ifElse .Meta.Unfree "unfree" "free"))) .LicenseNames }}
+{{ with .Meta.MainProgram }}{{ prop "main program" "" (code (print "$ " .)) }}
+{{ end -}}
+{{ with .Meta.Platforms }}{{ prop "platforms" "" (platforms .) }}
+{{ end -}}
+`
 
-	mainProg := ""
-	if pkg.Meta.MainProgram != "" {
-		mainProg = textutil.Prop(
-			"main program", "",
-			style.PrintCodeBlock("$ "+pkg.Meta.MainProgram),
-		)
-		fmt.Fprintln(out, mainProg)
-	}
+var previewTemplate = textutil.MustParseTemplate("nur", PreviewTemplate)
 
-	platforms := ""
-	if len(pkg.Meta.Platforms) > 0 {
-		platforms = textutil.Prop(
-			"platforms", "",
-			textutil.Platforms(pkg.Meta.Platforms),
-		)
-		fmt.Fprintln(out, platforms)
-	}
-}
-
-func licensesString(ls []nixpkgs.License) string {
-	if len(ls) == 0 {
-		return "No License"
-	}
-
-	ss := []string{}
-	for _, l := range ls {
-		ss = append(ss, cmp.Or(l.SpdxID, l.FullName))
-	}
-
-	return strings.Join(ss, "\n")
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
@@ -6,8 +6,8 @@ import (
 	"io"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
 )
 
 type Package struct {
@@ -19,34 +19,21 @@ type Package struct {
 	Default      String   `json:"default"`
 }
 
-func (pkg *Package) Preview(out io.Writer) {
-	styler := style.StyledText
-
-	pkgTitle := textutil.PkgName(pkg.Name) + "\n"
-	fmt.Fprint(out, pkgTitle)
-
-	desc := style.StyleLongDescription(styler, string(pkg.Description))
-	desc += "\n"
-	fmt.Fprintln(out, desc)
+// PreviewTemplate is the default preview of the options
+const PreviewTemplate = `{{ name .Name }}
+{{ markdown .Description }}
 
-	pkgType := textutil.Prop("type", "", pkg.Type)
-	fmt.Fprintln(out, pkgType)
+{{ prop "type" "" .Type }}
+{{ with .Default }}{{ prop "default" "" (code (print .)) }}
+{{ end -}}
+{{ with .Example }}{{ prop "example" "" (code (print .)) }}
+{{ end -}}
+`
 
-	if def := string(pkg.Default); def != "" {
-		def = textutil.Prop(
-			"default", "",
-			style.PrintCodeBlock(def),
-		)
-		fmt.Fprintln(out, def)
-	}
+var previewTemplate = textutil.MustParseTemplate("options-file", PreviewTemplate)
 
-	if example := string(pkg.Example); example != "" {
-		example = textutil.Prop(
-			"example", "",
-			style.PrintCodeBlock(example),
-		)
-		fmt.Fprintln(out, example)
-	}
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
 
 func (pkg *Package) GetSource() string {
@@ -61,6 +48,22 @@ func (pkg *Package) GetHomepage() string {
 	return pkg.GetSource()
 }
 
+func (pkg *Package) GetInfo() pkginfo.Info {
+	declarations := []string{}
+	for _, decl := range pkg.Declarations {
+		declarations = append(declarations, string(decl))
+	}
+
+	return pkginfo.Info{
+		Name:         pkg.Name,
+		Description:  pkg.Description,
+		Type:         pkg.Type,
+		Default:      string(pkg.Default),
+		Example:      string(pkg.Example),
+		Declarations: declarations,
+	}
+}
+
 // String is type that can be decoded from either a string, or an object with
 // certain fields often used in options.json files e.g. text, url
 type String string
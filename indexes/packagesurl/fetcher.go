@@ -0,0 +1,45 @@
+// Package packagesurl indexes a packages.json in the nixpkgs
+// format, optionally compressed, served at any url
+package packagesurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
+	"github.com/3timeslazy/nix-search-tv/indexes/readutil"
+)
+
+type Fetcher struct {
+	url  string
+	page httputil.Page
+}
+
+func NewFetcher(url string) *Fetcher {
+	return &Fetcher{
+		url: url,
+	}
+}
+
+// GetLatestRelease returns the release built from the ETag of the file,
+// so the file is indexed again only if it changed. See `httputil.Page`
+func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return f.page.Release(ctx, f.url, md.CurrRelease)
+}
+
+func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
+	file, err := f.page.Open(ctx, f.url, release)
+	if err != nil {
+		return nil, fmt.Errorf("fetch packages: %w", err)
+	}
+
+	pkgs, err := readutil.Decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("decompress packages: %w", err)
+	}
+
+	return pkgs, nil
+}
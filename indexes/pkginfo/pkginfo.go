@@ -0,0 +1,18 @@
+// Package pkginfo defines the package fields shared by all indexes, so that
+// packages and options of any index can be printed in the same way
+package pkginfo
+
+// Info is the normalized package or option. The package fields, like
+// licenses, are empty for options and vice versa
+type Info struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Licenses     []string `json:"licenses,omitempty"`
+	Homepages    []string `json:"homepages,omitempty"`
+	Platforms    []string `json:"platforms,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Default      string   `json:"default,omitempty"`
+	Example      string   `json:"example,omitempty"`
+	Declarations []string `json:"declarations,omitempty"`
+}
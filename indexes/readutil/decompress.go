@@ -0,0 +1,77 @@
+package readutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+type decompressReadCloser struct {
+	io.Reader
+	rd    io.Closer
+	close func()
+}
+
+func (d *decompressReadCloser) Close() error {
+	if d.close != nil {
+		d.close()
+	}
+	return d.rd.Close()
+}
+
+// Decompress detects how the json is compressed by its magic bytes and
+// decompresses it. gzip, zstd, xz and brotli are supported, and an
+// uncompressed json is returned as is. Brotli has no magic bytes, so
+// anything that is neither of the others nor starts like json is
+// expected to be brotli
+func Decompress(rd io.ReadCloser) (io.ReadCloser, error) {
+	brd := bufio.NewReader(rd)
+	head, err := brd.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(brd)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		return &decompressReadCloser{Reader: gz, rd: rd}, nil
+
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(brd)
+		if err != nil {
+			return nil, fmt.Errorf("open zstd: %w", err)
+		}
+		return &decompressReadCloser{Reader: zr, rd: rd, close: zr.Close}, nil
+
+	case bytes.HasPrefix(head, xzMagic):
+		xr, err := xz.NewReader(brd)
+		if err != nil {
+			return nil, fmt.Errorf("open xz: %w", err)
+		}
+		return &decompressReadCloser{Reader: xr, rd: rd}, nil
+
+	case isJSON(head):
+		return &decompressReadCloser{Reader: brd, rd: rd}, nil
+	}
+
+	return NewBrotli(&decompressReadCloser{Reader: brd, rd: rd}), nil
+}
+
+func isJSON(head []byte) bool {
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return len(head) > 0 && head[0] == '{'
+}
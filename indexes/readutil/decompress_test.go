@@ -0,0 +1,61 @@
+package readutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDecompress(t *testing.T) {
+	const pkgs = `{"packages":{"fzf":{}}}`
+
+	compress := map[string]func(io.Writer) (io.WriteCloser, error){
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		"zstd": func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		"xz": func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+		"brotli": func(w io.Writer) (io.WriteCloser, error) {
+			return brotli.NewWriter(w), nil
+		},
+	}
+
+	for name, newWriter := range compress {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := newWriter(buf)
+			assert.NoError(t, err)
+			_, err = io.WriteString(w, pkgs)
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+
+			assert.Equal(t, pkgs, decompress(t, buf.Bytes()))
+		})
+	}
+
+	t.Run("uncompressed", func(t *testing.T) {
+		assert.Equal(t, "\n "+pkgs, decompress(t, []byte("\n "+pkgs)))
+	})
+}
+
+func decompress(t *testing.T, data []byte) string {
+	t.Helper()
+
+	rd, err := Decompress(io.NopCloser(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	defer rd.Close()
+
+	out, err := io.ReadAll(rd)
+	assert.NoError(t, err)
+	return string(out)
+}
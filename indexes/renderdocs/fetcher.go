@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"time"
 
 	"github.com/3timeslazy/nix-search-tv/indexer"
+	"github.com/3timeslazy/nix-search-tv/indexes/httputil"
 	"github.com/3timeslazy/nix-search-tv/indexes/readutil"
 	"github.com/3timeslazy/nix-search-tv/pkgs/renderdocs"
 
@@ -28,7 +28,8 @@ type Package struct {
 }
 
 type Fetcher struct {
-	url string
+	url  string
+	page httputil.Page
 }
 
 func NewFetcher(url string) *Fetcher {
@@ -37,11 +38,11 @@ func NewFetcher(url string) *Fetcher {
 	}
 }
 
-func (f *Fetcher) GetLatestRelease(_ context.Context, _ indexer.IndexMetadata) (string, error) {
-	return time.Now().String(), nil
+func (f *Fetcher) GetLatestRelease(ctx context.Context, md indexer.IndexMetadata) (string, error) {
+	return f.page.Release(ctx, f.url, md.CurrRelease)
 }
 
-func (f *Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadCloser, error) {
+func (f *Fetcher) DownloadRelease(ctx context.Context, release string) (io.ReadCloser, error) {
 	var doc *html.Node
 	var err error
 
@@ -49,7 +50,7 @@ func (f *Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadClo
 	if ok {
 		doc, err = htmlquery.LoadDoc(path)
 	} else {
-		doc, err = htmlquery.LoadURL(f.url)
+		doc, err = f.loadPage(ctx, release)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("download options.xhtml: %w", err)
@@ -84,3 +85,13 @@ func (f *Fetcher) DownloadRelease(_ context.Context, release string) (io.ReadClo
 
 	return readutil.PackagesWrapper(io.NopCloser(buf)), nil
 }
+
+func (f *Fetcher) loadPage(ctx context.Context, release string) (*html.Node, error) {
+	page, err := f.page.Open(ctx, f.url, release)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+
+	return htmlquery.Parse(page)
+}
@@ -5,36 +5,26 @@ import (
 	"io"
 	"strings"
 
+	"github.com/3timeslazy/nix-search-tv/indexes/pkginfo"
 	"github.com/3timeslazy/nix-search-tv/indexes/textutil"
-	"github.com/3timeslazy/nix-search-tv/style"
+	"github.com/3timeslazy/nix-search-tv/pkgs/renderdocs"
 )
 
-func (pkg *Package) Preview(out io.Writer) {
-	pkgTitle := textutil.PkgName(pkg.Name) + "\n"
-	fmt.Fprint(out, pkgTitle)
-
-	desc := strings.TrimSpace(pkg.Description)
-	desc = style.StyleHTML(desc)
-	fmt.Fprintln(out, desc+"\n")
-
-	typ := textutil.Prop("type", "", pkg.Type)
-	fmt.Fprintln(out, typ)
-
-	if pkg.Default != "" {
-		def := textutil.Prop(
-			"default", "",
-			style.PrintCodeBlock(pkg.Default),
-		)
-		fmt.Fprintln(out, def)
-	}
+// PreviewTemplate is the default preview of the options
+const PreviewTemplate = `{{ name .Name }}
+{{ html (trim .Description) }}
 
-	if pkg.Example != "" {
-		example := textutil.Prop(
-			"example", "",
-			style.PrintCodeBlock(pkg.Example),
-		)
-		fmt.Fprintln(out, example)
-	}
+{{ prop "type" "" .Type }}
+{{ with .Default }}{{ prop "default" "" (code .) }}
+{{ end -}}
+{{ with .Example }}{{ prop "example" "" (code .) }}
+{{ end -}}
+`
+
+var previewTemplate = textutil.MustParseTemplate("render-docs", PreviewTemplate)
+
+func (pkg *Package) Preview(out io.Writer) {
+	textutil.Render(out, previewTemplate, pkg)
 }
 
 func (pkg *Package) GetSource() string {
@@ -56,3 +46,14 @@ func (pkg *Package) GetSource() string {
 func (pkg *Package) GetHomepage() string {
 	return pkg.GetSource()
 }
+
+func (pkg *Package) GetInfo() pkginfo.Info {
+	return pkginfo.Info{
+		Name:         pkg.Name,
+		Description:  renderdocs.RenderHTML(strings.TrimSpace(pkg.Description)),
+		Type:         pkg.Type,
+		Default:      pkg.Default,
+		Example:      pkg.Example,
+		Declarations: pkg.DeclaredBy,
+	}
+}
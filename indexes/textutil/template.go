@@ -0,0 +1,57 @@
+package textutil
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/3timeslazy/nix-search-tv/style"
+)
+
+// TemplateFuncs returns the functions available in the preview
+// templates. They are the same helpers the builtin previews use
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"name":      PkgName,
+		"prop":      Prop,
+		"platforms": Platforms,
+		"ifElse":    IfElse,
+		"code":      style.PrintCodeBlock,
+		"wrap":      style.Wrap,
+		"html":      style.StyleHTML,
+		"markdown": func(text string) string {
+			return style.StyleLongDescription(s, text)
+		},
+		"dim":        s.Dim,
+		"bold":       s.Bold,
+		"red":        s.Red,
+		"join":       strings.Join,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": strings.TrimPrefix,
+	}
+}
+
+// MustParseTemplate parses a builtin preview template
+// and panics if it is invalid
+func MustParseTemplate(name, text string) *template.Template {
+	return template.Must(ParseTemplate(name, text, nil))
+}
+
+// ParseTemplate parses a preview template. The extra functions
+// are added to, or override, the ones from `TemplateFuncs`
+func ParseTemplate(name, text string, extra template.FuncMap) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=zero").
+		Funcs(TemplateFuncs()).
+		Funcs(extra).
+		Parse(text)
+}
+
+// Render writes the preview of the package. Previews cannot fail,
+// so if the template does, the error is printed instead
+func Render(out io.Writer, tmpl *template.Template, pkg any) {
+	if err := tmpl.Execute(out, pkg); err != nil {
+		fmt.Fprintf(out, "render preview: %s\n", err)
+	}
+}
@@ -106,11 +106,11 @@ SEARCH_SNIPPET_CMD="$SEARCH_SNIPPET_CMD | tr -d \"\'\" "
 SEARCH_SNIPPET_CMD="$SEARCH_SNIPPET_CMD | awk \'{ if (\$2) { print \$2 } else print \$1 }\' "
 SEARCH_SNIPPET_CMD="$SEARCH_SNIPPET_CMD | xargs printf \"https://github.com/search?type=code&q=lang:nix+%s\" \$1 "
 
-NIX_SHELL_CMD='nix shell $(echo "{}" | sed "s/\/ /#/g"'
-NIX_SHELL_CMD="$NIX_SHELL_CMD | tr -d \"\'\")"
-
-YAZI_EXPLORE_CMD='yazi $(nix build --no-link --print-out-paths $(echo "{}" | sed "s/\/ /#/g"'
-YAZI_EXPLORE_CMD="$YAZI_EXPLORE_CMD | tr -d \"\'\"))"
+# the installable is passed as a single argument, so that
+# the package name is never interpreted by the shell
+INSTALLABLE_CMD="$CMD snippet --style installable \$(cat $STATE_FILE) {}"
+NIX_SHELL_CMD="nix shell \"\$($INSTALLABLE_CMD)\""
+YAZI_EXPLORE_CMD="yazi \"\$(nix build --no-link --print-out-paths \"\$($INSTALLABLE_CMD)\")\""
 
 PREVIEW_WINDOW="wrap"
 [ "$(tput cols)" -lt 90 ] && PREVIEW_WINDOW="$PREVIEW_WINDOW,up"
@@ -1,6 +1,7 @@
 package style
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -60,3 +61,10 @@ func (s TextStyler) styleTextBlock(text string, prefix, suffix string) string {
 	}
 	return strings.Join(lines, "\n")
 }
+
+var reANSI = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// StripANSI removes the styles from the text
+func StripANSI(text string) string {
+	return reANSI.ReplaceAllString(text, "")
+}